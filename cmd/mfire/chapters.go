@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/galpt/go-mfire/pkg/mfire"
+)
+
+// runChapters implements `mfire chapters URL`, which lists a manga's
+// chapters in the best available language per the -lang preferences.
+// With -uploads it lists every upload of each chapter instead, marking
+// the one chosen by the -dedupe rules.
+func runChapters(client *mfire.Client, args []string) error {
+	fs := flag.NewFlagSet("chapters", flag.ContinueOnError)
+	uploads := fs.Bool("uploads", false, "list every upload of each chapter, * marking the one downloads use")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mfire [-lang CODES] [-dedupe RULES] chapters [-uploads] MANGA_URL")
+	}
+	manga, err := mfire.ParseMangaURL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	groups, err := client.ChapterUploads(context.Background(), manga)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if !*uploads {
+			printChapter("", g.Best)
+			continue
+		}
+		for _, ch := range g.Chapters {
+			mark := " "
+			if ch.ID == g.Best.ID {
+				mark = "*"
+			}
+			printChapter(mark, ch)
+		}
+	}
+	return nil
+}
+
+func printChapter(mark string, ch mfire.Chapter) {
+	date := ""
+	if !ch.Date.IsZero() {
+		date = ch.Date.Format("2006-01-02")
+	}
+	fmt.Printf("%s%-8s %-5s %-10s %s\n", mark, mfire.FormatNumber(ch.Number), ch.Language, date, ch.Title)
+}
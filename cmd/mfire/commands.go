@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/galpt/go-mfire/pkg/mfire"
+)
+
+// runCommand dispatches the non-interactive subcommands.
+func runCommand(client *mfire.Client, args []string) error {
+	switch args[0] {
+	case "fixtures":
+		return runFixtures(client, args[1:])
+	case "chapters":
+		return runChapters(client, args[1:])
+	case "download":
+		return runDownload(client, args[1:])
+	case "resume":
+		return runResume(client, args[1:])
+	case "queue":
+		return runQueue(client, args[1:])
+	case "mark":
+		return runMark(client, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/galpt/go-mfire/pkg/mfire"
+)
+
+// runDownload implements `mfire download`, which saves the pages of one
+// chapter, or of the chapters and volumes picked by the selection flags,
+// as image files, CBZ archives, EPUB books or PDFs.
+func runDownload(client *mfire.Client, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	dir := fs.String("dir", "downloads", "directory to download into")
+	format := fs.String("format", "images", "output format: images, cbz, epub or pdf")
+	device := fs.String("device", "", "EPUB only: scale pages for this device ("+strings.Join(mfire.DeviceNames(), ", ")+")")
+	workers := fs.Int("workers", 4, "pages fetched concurrently")
+	number := fs.String("chapter", "", "chapter number, when URL is a manga page")
+	process := fs.String("process", "", "convert pages with this image profile ("+strings.Join(mfire.ImageProfileNames(), ", ")+") or JSON profile file")
+	mark := fs.Bool("mark", false, "mark the downloaded chapters read in the -state file")
+	var naming namingFlags
+	naming.register(fs)
+	var sel selectFlags
+	sel.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mfire [-lang CODES] download [-dir DIR] [-format images|cbz|epub|pdf] [-device NAME] [-process PROFILE] [-workers N] [-chapter N | -chapters RANGES] [-volume RANGES] [-latest N] [-unread] [-mark] [-state FILE] [-name TEMPLATE] [-collision POLICY] [-dry-run] URL")
+	}
+	proc, err := imageProfile(*process)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "images", "cbz", "epub", "pdf":
+	default:
+		return fmt.Errorf("-format: unknown format %q", *format)
+	}
+	var epubOpts mfire.EPUBOptions
+	if *device != "" {
+		dp, ok := mfire.LookupDevice(*device)
+		if !ok {
+			return fmt.Errorf("-device: unknown device %q", *device)
+		}
+		epubOpts.Device = &dp
+	}
+	ctx := context.Background()
+
+	targets, err := sel.targets(ctx, client, fs.Arg(0), *number, *format)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		fmt.Println("nothing to download: no chapter selected")
+		return nil
+	}
+	chapters := make([]mfire.Chapter, len(targets))
+	for i, t := range targets {
+		chapters[i] = t.chapter
+	}
+	plan, details, err := naming.plan(ctx, client, *dir, *format, chapters)
+	if err != nil || naming.dryRun {
+		return err
+	}
+	if proc != nil && details == nil {
+		if details, err = client.Details(ctx, chapters[0].Manga); err != nil {
+			return err
+		}
+	}
+	var read *mfire.ReadState
+	if *mark {
+		if read, err = sel.readState(); err != nil {
+			return err
+		}
+	}
+
+	d := mfire.NewDownloader(client)
+	d.Workers = *workers
+	d.Process = proc
+	d.Progress = printProgress
+	for i, p := range plan {
+		if p.Skip {
+			fmt.Printf("%s exists, skipping\n", p.Path)
+			continue
+		}
+		t := targets[i]
+		if err := t.download(ctx, d, details, *format, p.Path, epubOpts); err != nil {
+			return err
+		}
+		if read != nil {
+			read.MarkRead(t.chapters()...)
+			if err := read.Save(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// target is one download: a chapter, or a volume bundled into one file.
+type target struct {
+	// chapter is the chapter, or the volume as VolumeGroup.Chapter
+	// describes it.
+	chapter mfire.Chapter
+	volume  *mfire.VolumeGroup
+}
+
+// chapters returns what the target downloads.
+func (t target) chapters() []mfire.Chapter {
+	if t.volume != nil {
+		return t.volume.Chapters
+	}
+	return []mfire.Chapter{t.chapter}
+}
+
+// download saves the target to path in format, printing progress.
+func (t target) download(ctx context.Context, d *mfire.Downloader, details *mfire.Details, format, path string, epubOpts mfire.EPUBOptions) error {
+	var pdfOpts mfire.PDFOptions
+	if t.volume != nil {
+		epubOpts.Title = t.volume.Title(details)
+		pdfOpts.Title = epubOpts.Title
+	}
+	var err error
+	switch format {
+	case "images":
+		var files []string
+		if files, err = d.DownloadProcessed(ctx, t.chapter, details, path); err == nil {
+			fmt.Printf("\nwrote %d pages to %s\n", len(files), path)
+			return nil
+		}
+	case "cbz":
+		if t.volume != nil {
+			err = d.DownloadVolumeCBZ(ctx, *t.volume, details, path)
+		} else {
+			err = d.DownloadCBZ(ctx, t.chapter, details, path)
+		}
+	case "epub":
+		err = d.DownloadEPUB(ctx, t.chapters(), details, path, epubOpts)
+	case "pdf":
+		err = d.DownloadPDF(ctx, t.chapters(), details, path, pdfOpts)
+	}
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", path)
+	return nil
+}
+
+// selectFlags are the flags picking several chapters of a manga.
+type selectFlags struct {
+	chapters string
+	volumes  string
+	latest   int
+	unread   bool
+	state    string
+	// all picks every chapter when no other flag narrows the selection.
+	all bool
+
+	read *mfire.ReadState
+}
+
+func (s *selectFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.chapters, "chapters", "", `chapter ranges, e.g. "1-10,15,20-"`)
+	fs.StringVar(&s.volumes, "volume", "", `volumes, e.g. "3" or "1-3", each bundled into one file unless -format is images`)
+	fs.IntVar(&s.latest, "latest", 0, "only the newest N chapters")
+	fs.BoolVar(&s.unread, "unread", false, "skip the chapters marked read in the -state file")
+	fs.StringVar(&s.state, "state", "mfire-read.json", "read state file")
+}
+
+func (s *selectFlags) set() bool {
+	return s.all || s.chapters != "" || s.volumes != "" || s.latest > 0 || s.unread
+}
+
+// names lists the selection flags that are set, e.g. "-chapters, -unread".
+func (s *selectFlags) names() string {
+	var names []string
+	if s.chapters != "" {
+		names = append(names, "-chapters")
+	}
+	if s.volumes != "" {
+		names = append(names, "-volume")
+	}
+	if s.latest > 0 {
+		names = append(names, "-latest")
+	}
+	if s.unread {
+		names = append(names, "-unread")
+	}
+	if s.all {
+		names = append(names, "-all")
+	}
+	return strings.Join(names, ", ")
+}
+
+// readState loads the -state file once.
+func (s *selectFlags) readState() (*mfire.ReadState, error) {
+	if s.read != nil {
+		return s.read, nil
+	}
+	read, err := mfire.LoadReadState(s.state)
+	if err != nil {
+		return nil, err
+	}
+	s.read = read
+	return read, nil
+}
+
+func (s *selectFlags) selection() (mfire.Selection, error) {
+	sel := mfire.Selection{Latest: s.latest}
+	var err error
+	if s.chapters != "" {
+		if sel.Ranges, err = mfire.ParseRanges(s.chapters); err != nil {
+			return sel, fmt.Errorf("-chapters: %w", err)
+		}
+	}
+	if s.volumes != "" {
+		if sel.Volumes, err = mfire.ParseRanges(s.volumes); err != nil {
+			return sel, fmt.Errorf("-volume: %w", err)
+		}
+	}
+	if s.unread {
+		if sel.Read, err = s.readState(); err != nil {
+			return sel, err
+		}
+	}
+	return sel, nil
+}
+
+// targets resolves URL to what is downloaded: the one chapter it or
+// -chapter names, or, with selection flags, the manga's chapters they
+// pick. With -volume and a file format each volume is one target, the
+// site's own volume when it offers one.
+func (s *selectFlags) targets(ctx context.Context, client *mfire.Client, rawurl, number, format string) ([]target, error) {
+	if !s.set() {
+		ch, err := resolveChapter(ctx, client, rawurl, number)
+		if err != nil {
+			return nil, err
+		}
+		return []target{{chapter: ch}}, nil
+	}
+	if number != "" {
+		return nil, fmt.Errorf("-chapter can't be combined with %s", s.names())
+	}
+	sel, err := s.selection()
+	if err != nil {
+		return nil, err
+	}
+	manga, err := mfire.ParseMangaURL(rawurl)
+	if err != nil {
+		ref, rerr := mfire.ParseReaderURL(rawurl)
+		if rerr != nil {
+			return nil, err
+		}
+		manga = ref.MangaRef
+	}
+	list, err := client.ChapterList(ctx, manga)
+	if err != nil {
+		return nil, err
+	}
+	var out []target
+	if s.volumes == "" || format == "images" {
+		for _, ch := range sel.Apply(list) {
+			out = append(out, target{chapter: ch})
+		}
+		return out, nil
+	}
+	volumes, err := client.VolumeList(ctx, manga)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range sel.Bundle(list, volumes) {
+		g := g
+		if g.Volume == 0 || len(g.Chapters) == 1 && g.Chapters[0].Kind == "volume" {
+			for _, ch := range g.Chapters {
+				out = append(out, target{chapter: ch})
+			}
+			continue
+		}
+		out = append(out, target{chapter: g.Chapter(), volume: &g})
+	}
+	return out, nil
+}
+
+// resolveChapter finds the chapter a reader URL points at, or chapter
+// number of a manga URL in the preferred languages.
+func resolveChapter(ctx context.Context, client *mfire.Client, rawurl, number string) (mfire.Chapter, error) {
+	if ref, err := mfire.ParseReaderURL(rawurl); err == nil {
+		return client.FindChapter(ctx, ref)
+	}
+	manga, err := mfire.ParseMangaURL(rawurl)
+	if err != nil {
+		return mfire.Chapter{}, err
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return mfire.Chapter{}, fmt.Errorf("-chapter: a chapter number is required with a manga URL")
+	}
+	chapters, err := client.ChapterList(ctx, manga)
+	if err != nil {
+		return mfire.Chapter{}, err
+	}
+	for _, ch := range chapters {
+		if ch.Number == n {
+			return ch, nil
+		}
+	}
+	return mfire.Chapter{}, fmt.Errorf("%w: %s chapter %s", mfire.ErrChapterNotFound, manga.ID, number)
+}
+
+// imageProfile resolves -process: a built-in profile name or a JSON file.
+func imageProfile(name string) (*mfire.ImageProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if strings.HasSuffix(strings.ToLower(name), ".json") {
+		p, err := mfire.LoadImageProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		return &p, nil
+	}
+	p, ok := mfire.LookupImageProfile(name)
+	if !ok {
+		return nil, fmt.Errorf("-process: unknown image profile %q", name)
+	}
+	return &p, nil
+}
+
+// namingFlags are the flags choosing where downloads are saved.
+type namingFlags struct {
+	template  string
+	collision string
+	dryRun    bool
+}
+
+func (n *namingFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&n.template, "name", mfire.DefaultNameTemplate, `path template under -dir, e.g. "{series}/{volume:02}/{series} - c{chapter:03} [{lang}]"`)
+	fs.StringVar(&n.collision, "collision", "", "when the path exists: rename, skip or overwrite (default skip for files, rename for images)")
+	fs.BoolVar(&n.dryRun, "dry-run", false, "print the planned paths without downloading")
+}
+
+// plan names chapters under dir, fetching the manga's details when the
+// format or the template needs them. With -dry-run it prints the plan.
+func (n *namingFlags) plan(ctx context.Context, client *mfire.Client, dir, format string, chapters []mfire.Chapter) ([]mfire.PlannedPath, *mfire.Details, error) {
+	tmpl, err := mfire.ParseNameTemplate(n.template)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy := mfire.DefaultCollision(format)
+	if n.collision != "" {
+		if policy, err = mfire.ParseCollision(n.collision); err != nil {
+			return nil, nil, err
+		}
+	}
+	var details *mfire.Details
+	if len(chapters) > 0 && (format != "images" || tmpl.NeedsDetails()) {
+		if details, err = client.Details(ctx, chapters[0].Manga); err != nil {
+			return nil, nil, err
+		}
+	}
+	plan := tmpl.Plan(dir, details, chapters, format, policy)
+	if n.dryRun {
+		for _, p := range plan {
+			note := ""
+			switch {
+			case p.Skip:
+				note = " (exists, skipped)"
+			case p.Exists && policy == mfire.CollisionOverwrite:
+				note = " (exists, overwritten)"
+			case p.Exists:
+				note = " (renamed, name taken)"
+			}
+			kind := p.Chapter.Kind
+			if kind == "" {
+				kind = "chapter"
+			}
+			fmt.Printf("%s %s [%s] -> %s%s\n", kind, mfire.FormatNumber(p.Chapter.Number), p.Chapter.Language, p.Path, note)
+		}
+	}
+	return plan, details, nil
+}
+
+// runResume implements `mfire resume`, which finishes interrupted image
+// downloads from the manifest in each directory. Interrupted CBZ, EPUB and
+// PDF downloads resume by running the same download command again.
+func runResume(client *mfire.Client, args []string) error {
+	fs := flag.NewFlagSet("resume", flag.ContinueOnError)
+	workers := fs.Int("workers", 4, "pages fetched concurrently")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: mfire resume [-workers N] DIR...")
+	}
+	d := mfire.NewDownloader(client)
+	d.Workers = *workers
+	d.Progress = printProgress
+	for _, dir := range fs.Args() {
+		m, err := mfire.LoadManifest(dir)
+		if err != nil {
+			return err
+		}
+		if m.Complete && m.Pending() == 0 {
+			fmt.Printf("%s: complete, verifying\n", dir)
+		}
+		files, err := d.Resume(context.Background(), dir)
+		fmt.Println()
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		fmt.Printf("%s: %d pages\n", dir, len(files))
+	}
+	return nil
+}
+
+// printProgress shows a chapter's download progress on one line, noting
+// pages kept from an earlier run.
+func printProgress(p mfire.Progress) {
+	if p.Err != nil {
+		fmt.Printf("\npage %d: %v\n", p.Page, p.Err)
+	}
+	var skipped string
+	if p.Skipped {
+		skipped = " (resuming)"
+	}
+	fmt.Printf("\r%s [%s]: %d/%d pages%-11s", p.Chapter.Title, p.Chapter.Language, p.Done, p.Total, skipped)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/galpt/go-mfire/pkg/mfire"
+)
+
+// runFixtures implements `mfire fixtures refresh`, which records live pages
+// over the hand-written test corpus used by pkg/mfire's tests.
+func runFixtures(client *mfire.Client, args []string) error {
+	if len(args) == 0 || args[0] != "refresh" {
+		return fmt.Errorf("usage: mfire fixtures refresh [-dir DIR] [-manga PATH] [-lang CODE]")
+	}
+	opts := mfire.DefaultFixtureOptions
+	fs := flag.NewFlagSet("fixtures refresh", flag.ContinueOnError)
+	dir := fs.String("dir", "pkg/mfire/testdata", "directory to write fixtures to")
+	fs.StringVar(&opts.MangaPath, "manga", opts.MangaPath, "detail page to record, e.g. /manga/one-piecee.dkw")
+	fs.StringVar(&opts.Language, "lang", opts.Language, "chapter language to record")
+	fs.StringVar(&opts.Query, "query", opts.Query, "search recorded as filter.html")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	written, err := mfire.RefreshFixtures(context.Background(), client, *dir, opts)
+	for _, path := range written {
+		fmt.Printf("wrote %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("genre.html and home_redesign.html have no live counterpart and stay hand-written")
+	fmt.Println("fixtures refreshed; run `go test ./...` to check the parsers against them")
+	return nil
+}
@@ -2,20 +2,54 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/galpt/go-mfire/pkg/mfire"
 )
 
 func main() {
-	client := mfire.NewClient()
+	var f cliFlags
+	flag.StringVar(&f.proxy, "proxy", "", "comma-separated proxy URLs (http, https, socks5); more than one enables rotation")
+	flag.StringVar(&f.profile, "profile", "", "comma-separated header profile names ("+strings.Join(mfire.ProfileNames(), ", ")+"); more than one enables rotation")
+	flag.BoolVar(&f.syncProfile, "sync-profile", false, "adopt the headless browser's user agent once the VRF fallback runs")
+	flag.StringVar(&f.cookies, "cookies", "", "persist cookies to this file (.json for JSON, otherwise Netscape cookies.txt)")
+	flag.StringVar(&f.importCookies, "import-cookies", "", "merge cookies exported from a browser into the -cookies file")
+	flag.StringVar(&f.cacheDir, "cache", "", "cache responses on disk in this directory")
+	flag.StringVar(&f.languages, "lang", "", "comma-separated preferred chapter languages, most preferred first (default en)")
+	flag.StringVar(&f.dedupe, "dedupe", "", "how to pick among uploads of the same chapter: comma-separated rules language, newest, pages (default language,newest)")
+	flag.StringVar(&f.selectors, "selectors", "", "JSON file of CSS selector overrides for parsing")
+	flag.StringVar(&f.record, "record", "", "record every HTTP interaction to this cassette file")
+	flag.StringVar(&f.replay, "replay", "", "serve HTTP responses from this cassette file instead of the network")
+	flag.Float64Var(&f.rate, "rate", 0, "limit requests to this many per second (0 for no limit)")
+	flag.IntVar(&f.hostLimit, "host-limit", 0, "limit concurrent requests to any one host (0 for no limit)")
+	flag.DurationVar(&f.cacheTTL, "cache-ttl", 0, "cache responses (in memory unless -cache is set) and serve them for at least this long")
+	flag.Parse()
+
+	opts, err := clientOptions(f)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	client := mfire.NewClient(opts...)
+
+	if flag.NArg() > 0 {
+		if err := runCommand(client, flag.Args()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
-		// Fetch and display top 10 on each loop so the user sees fresh results.
+		// Fetch and display top 10 on each loop so the user sees fresh results
+		// (up to -cache-ttl old when caching).
 		mangas, err := client.FetchHome(10)
 		if err != nil {
 			fmt.Printf("Error fetching home: %v\n", err)
@@ -76,3 +110,126 @@ func main() {
 		fmt.Println("unknown command")
 	}
 }
+
+// cliFlags holds the command-line flags that configure the client.
+type cliFlags struct {
+	proxy       string
+	profile     string
+	syncProfile bool
+
+	cookies       string
+	importCookies string
+
+	cacheDir string
+	cacheTTL time.Duration
+
+	languages string
+	dedupe    string
+	selectors string
+	rate      float64
+	hostLimit int
+
+	record string
+	replay string
+}
+
+// clientOptions translates command-line flags into client options.
+func clientOptions(f cliFlags) ([]mfire.Option, error) {
+	opts := []mfire.Option{mfire.WithWarnings(func(err error) {
+		fmt.Printf("Warning: %v\n", err)
+	})}
+	if f.proxy != "" {
+		list := strings.Split(f.proxy, ",")
+		if len(list) == 1 {
+			u, err := mfire.ParseProxyURL(list[0])
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, mfire.WithProxy(u))
+		} else {
+			pool, err := mfire.NewProxyPool(list...)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, mfire.WithProxyPool(pool))
+		}
+	}
+	if f.profile != "" {
+		var profiles []mfire.HeaderProfile
+		for _, name := range strings.Split(f.profile, ",") {
+			p, ok := mfire.LookupProfile(strings.TrimSpace(name))
+			if !ok {
+				return nil, fmt.Errorf("unknown header profile %q", name)
+			}
+			profiles = append(profiles, p)
+		}
+		opts = append(opts, mfire.WithProfileRotation(profiles...))
+	}
+	if f.syncProfile {
+		opts = append(opts, mfire.WithBrowserProfileSync())
+	}
+	if f.importCookies != "" && f.cookies == "" {
+		return nil, fmt.Errorf("-import-cookies requires -cookies")
+	}
+	if f.cookies != "" {
+		jar, err := mfire.NewFileJar(f.cookies)
+		if err != nil {
+			return nil, err
+		}
+		if f.importCookies != "" {
+			n, err := jar.Import(f.importCookies)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf("imported %d cookies into %s\n", n, f.cookies)
+		}
+		opts = append(opts, mfire.WithCookieJar(jar))
+	}
+	if f.cacheDir != "" || f.cacheTTL > 0 {
+		var store mfire.CacheStore = mfire.NewMemoryCache(256)
+		if f.cacheDir != "" {
+			disk, err := mfire.NewDiskCache(f.cacheDir)
+			if err != nil {
+				return nil, err
+			}
+			store = disk
+		}
+		opts = append(opts, mfire.WithCache(store, f.cacheTTL))
+	}
+	switch {
+	case f.record != "" && f.replay != "":
+		return nil, fmt.Errorf("-record and -replay are mutually exclusive")
+	case f.record != "":
+		opts = append(opts, mfire.WithRecorder(mfire.NewRecordingTransport(f.record, nil)))
+	case f.replay != "":
+		rt, err := mfire.LoadReplayTransport(f.replay)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mfire.WithTransport(rt))
+	}
+	if f.rate > 0 {
+		opts = append(opts, mfire.WithRateLimit(f.rate, 1))
+	}
+	if f.hostLimit > 0 {
+		opts = append(opts, mfire.WithHostLimit(f.hostLimit))
+	}
+	if f.languages != "" {
+		opts = append(opts, mfire.WithLanguages(mfire.ParseLanguages(f.languages)...))
+	}
+	if f.dedupe != "" {
+		rules, err := mfire.ParseDedupeRules(f.dedupe)
+		if err != nil {
+			return nil, fmt.Errorf("-dedupe: %w", err)
+		}
+		opts = append(opts, mfire.WithDedupeRules(rules...))
+	}
+	if f.selectors != "" {
+		sel, err := mfire.LoadSelectors(f.selectors)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mfire.WithSelectors(sel))
+	}
+	return opts, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/galpt/go-mfire/pkg/mfire"
+)
+
+// runMark implements `mfire mark`, which marks chapters of a manga read,
+// or unread with -undo, in the read state file used by -unread.
+func runMark(client *mfire.Client, args []string) error {
+	fs := flag.NewFlagSet("mark", flag.ContinueOnError)
+	state := fs.String("state", "mfire-read.json", "read state file")
+	chapters := fs.String("chapters", "", `chapter ranges, e.g. "1-10,15,20-"; all when neither this nor -volume is given`)
+	volumes := fs.String("volume", "", `volumes, e.g. "3" or "1-3"; marks their chapters and the volumes themselves`)
+	undo := fs.Bool("undo", false, "mark unread instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mfire mark [-state FILE] [-chapters RANGES] [-volume RANGES] [-undo] URL")
+	}
+	var sel mfire.Selection
+	var err error
+	if *chapters != "" {
+		if sel.Ranges, err = mfire.ParseRanges(*chapters); err != nil {
+			return fmt.Errorf("-chapters: %w", err)
+		}
+	}
+	if *volumes != "" {
+		if sel.Volumes, err = mfire.ParseRanges(*volumes); err != nil {
+			return fmt.Errorf("-volume: %w", err)
+		}
+	}
+	manga, err := mfire.ParseMangaURL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	list, err := client.ChapterList(ctx, manga)
+	if err != nil {
+		return err
+	}
+	picked := sel.Apply(list)
+	if len(sel.Volumes) > 0 {
+		vols, err := client.VolumeList(ctx, manga)
+		if err != nil {
+			return err
+		}
+		picked = append(picked, mfire.Selection{Volumes: sel.Volumes}.Apply(vols)...)
+	}
+	read, err := mfire.LoadReadState(*state)
+	if err != nil {
+		return err
+	}
+	if *undo {
+		read.MarkUnread(picked...)
+	} else {
+		read.MarkRead(picked...)
+	}
+	if err := read.Save(); err != nil {
+		return err
+	}
+	verb := "read"
+	if *undo {
+		verb = "unread"
+	}
+	fmt.Printf("marked %d chapters %s in %s\n", len(picked), verb, read.Path())
+	return nil
+}
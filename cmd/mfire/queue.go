@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/galpt/go-mfire/pkg/mfire"
+)
+
+const queueUsage = `usage: mfire queue [-file FILE] COMMAND
+commands:
+  add [-dir DIR] [-format F] [-device NAME] [-process PROFILE] [-priority N]
+      [-chapter N | -all | -chapters RANGES] [-volume RANGES] [-latest N]
+      [-unread] [-state FILE] [-name TEMPLATE] [-collision POLICY] [-dry-run] URL
+  list
+  run [-jobs N] [-workers N] [-attempts N]
+  pause ID...
+  resume ID...
+  cancel ID...
+  priority ID N
+  prune`
+
+// runQueue implements `mfire queue`, which manages the download queue:
+// adding chapters, listing, pausing, resuming and cancelling jobs, and
+// running it.
+func runQueue(client *mfire.Client, args []string) error {
+	fs := flag.NewFlagSet("queue", flag.ContinueOnError)
+	file := fs.String("file", "mfire-queue.json", "queue file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New(queueUsage)
+	}
+	q, err := mfire.OpenQueue(*file)
+	if err != nil {
+		return err
+	}
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "add":
+		return queueAdd(client, q, args)
+	case "list":
+		return queueList(q)
+	case "run":
+		return queueRun(client, q, args)
+	case "pause", "resume", "cancel":
+		ids, err := jobIDs(args)
+		if err != nil {
+			return err
+		}
+		switch cmd {
+		case "pause":
+			return q.Pause(ids...)
+		case "resume":
+			return q.Resume(ids...)
+		}
+		return q.Cancel(ids...)
+	case "priority":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: mfire queue priority ID N")
+		}
+		ids, err := jobIDs(args[:1])
+		if err != nil {
+			return err
+		}
+		p, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("priority: %w", err)
+		}
+		return q.SetPriority(ids[0], p)
+	case "prune":
+		n, err := q.Prune()
+		if err == nil {
+			fmt.Printf("removed %d jobs\n", n)
+		}
+		return err
+	}
+	return errors.New(queueUsage)
+}
+
+func jobIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no job IDs given")
+	}
+	ids := make([]int, len(args))
+	for i, a := range args {
+		id, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, fmt.Errorf("job ID %q: %w", a, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// queueAdd queues one chapter, every chapter of a manga with -all, or the
+// chapters and volumes picked by the selection flags.
+func queueAdd(client *mfire.Client, q *mfire.Queue, args []string) error {
+	fs := flag.NewFlagSet("queue add", flag.ContinueOnError)
+	dir := fs.String("dir", "downloads", "directory to download into")
+	format := fs.String("format", "images", "output format: images, cbz, epub or pdf")
+	device := fs.String("device", "", "EPUB only: scale pages for this device ("+strings.Join(mfire.DeviceNames(), ", ")+")")
+	priority := fs.Int("priority", 0, "higher runs first")
+	number := fs.String("chapter", "", "chapter number, when URL is a manga page")
+	all := fs.Bool("all", false, "queue every chapter, when URL is a manga page")
+	var sel selectFlags
+	sel.register(fs)
+	process := fs.String("process", "", "convert pages with this image profile ("+strings.Join(mfire.ImageProfileNames(), ", ")+") or JSON profile file")
+	var naming namingFlags
+	naming.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mfire queue add [-dir DIR] [-format F] [-device NAME] [-process PROFILE] [-priority N] [-chapter N | -all | -chapters RANGES] [-volume RANGES] [-latest N] [-unread] [-state FILE] [-name TEMPLATE] [-collision POLICY] [-dry-run] URL")
+	}
+	switch *format {
+	case "images", "cbz", "epub", "pdf":
+	default:
+		return fmt.Errorf("-format: unknown format %q", *format)
+	}
+	if _, ok := mfire.LookupDevice(*device); *device != "" && !ok {
+		return fmt.Errorf("-device: unknown device %q", *device)
+	}
+	proc, err := imageProfile(*process)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	sel.all = *all
+	targets, err := sel.targets(ctx, client, fs.Arg(0), *number, *format)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		fmt.Println("nothing to queue: no chapter selected")
+		return nil
+	}
+	chapters := make([]mfire.Chapter, len(targets))
+	for i, t := range targets {
+		chapters[i] = t.chapter
+	}
+	plan, _, err := naming.plan(ctx, client, *dir, *format, chapters)
+	if err != nil || naming.dryRun {
+		return err
+	}
+	var jobs []mfire.Job
+	for i, p := range plan {
+		if p.Skip {
+			continue
+		}
+		job := mfire.Job{Chapter: p.Chapter, Format: *format, Path: p.Path, Device: *device, Process: proc, Priority: *priority}
+		if v := targets[i].volume; v != nil {
+			job.Bundle = v.Chapters
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("nothing to queue: every chapter exists")
+		return nil
+	}
+	added, err := q.Add(jobs...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("queued %d jobs (%d-%d)\n", len(added), added[0].ID, added[len(added)-1].ID)
+	return nil
+}
+
+func queueList(q *mfire.Queue) error {
+	jobs, err := q.Jobs()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tPRI\tCHAPTER\tPATH\tNOTE")
+	for _, j := range jobs {
+		var note string
+		if j.Error != "" {
+			note = fmt.Sprintf("attempt %d: %s", j.Attempts, j.Error)
+		}
+		if j.State == mfire.JobQueued && !j.NextAttempt.IsZero() {
+			note += ", retry at " + j.NextAttempt.Local().Format("15:04:05")
+		}
+		number := mfire.FormatNumber(j.Chapter.Number)
+		if j.Chapter.Kind == "volume" {
+			number = "vol. " + number
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s %s [%s]\t%s\t%s\n", j.ID, j.State, j.Priority,
+			j.Chapter.Manga.Slug, number, j.Chapter.Language, j.Path, note)
+	}
+	return w.Flush()
+}
+
+// queueRun works through the queue until it is empty; Ctrl-C stops it,
+// leaving unfinished jobs queued.
+func queueRun(client *mfire.Client, q *mfire.Queue, args []string) error {
+	fs := flag.NewFlagSet("queue run", flag.ContinueOnError)
+	jobs := fs.Int("jobs", 1, "chapters downloaded at once")
+	workers := fs.Int("workers", 4, "pages fetched concurrently per chapter")
+	attempts := fs.Int("attempts", 5, "tries per job before it is marked failed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d := mfire.NewDownloader(client)
+	d.Workers = *workers
+	r := &mfire.QueueRunner{Queue: q, Downloader: d, Jobs: *jobs, MaxAttempts: *attempts}
+	r.OnChange = func(j mfire.Job) {
+		msg := string(j.State)
+		if j.Error != "" {
+			msg += ": " + j.Error
+		}
+		fmt.Printf("job %d %s chapter %s: %s\n", j.ID, j.Chapter.Manga.Slug, mfire.FormatNumber(j.Chapter.Number), msg)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := r.Run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ go 1.20
 require (
 	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/chromedp/cdproto v0.0.0-20220321060548-7bc2623472b3
+	golang.org/x/image v0.18.0
 )
 
 require (
@@ -20,5 +21,5 @@ require (
 require (
 	github.com/andybalholm/cascadia v1.3.1 // indirect
 	github.com/chromedp/chromedp v0.8.0
-	golang.org/x/net v0.0.0-20210916014120-12bc252f5db8 // indirect
+	golang.org/x/net v0.0.0-20210916014120-12bc252f5db8
 )
@@ -0,0 +1,135 @@
+package mfire
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Listing is a paginated category page of the site, identified by its path.
+type Listing struct {
+	Path string `json:"path"` // e.g. "/genre/action"
+}
+
+// The site-wide listings.
+var (
+	ListingNewest  = Listing{Path: "/newest"}
+	ListingUpdated = Listing{Path: "/updated"}
+	ListingAdded   = Listing{Path: "/added"}
+)
+
+// GenreListing returns the listing of a genre, given its slug or its name
+// as reported by Taxonomy ("action", "Boys Love").
+func GenreListing(genre string) Listing {
+	return Listing{Path: "/genre/" + categorySlug(genre)}
+}
+
+// TypeListing returns the listing of a type such as "manhwa" or "one_shot".
+func TypeListing(typ string) Listing {
+	return Listing{Path: "/type/" + url.PathEscape(strings.ToLower(strings.TrimSpace(typ)))}
+}
+
+// AZListing returns the alphabetical listing of titles starting with
+// letter ("A", "0-9"), or of every title when letter is empty.
+func AZListing(letter string) Listing {
+	letter = strings.TrimSpace(letter)
+	if letter == "" {
+		return Listing{Path: "/az-list"}
+	}
+	return Listing{Path: "/az-list/" + url.PathEscape(strings.ToUpper(letter))}
+}
+
+// URL returns the absolute URL of page n of the listing.
+func (l Listing) URL(n int) string {
+	u := absURL(l.Path)
+	if n > 1 {
+		u += "?page=" + strconv.Itoa(n)
+	}
+	return u
+}
+
+// ListingPage is one page of a listing.
+type ListingPage struct {
+	Mangas []Manga `json:"mangas"`
+	Page   int     `json:"page"`
+	// LastPage is the number of the last page, or 0 when the pagination
+	// doesn't link to it.
+	LastPage int  `json:"lastPage"`
+	HasNext  bool `json:"hasNext"`
+}
+
+// Browse fetches page n (1-based) of a listing.
+func (c *Client) Browse(ctx context.Context, l Listing, n int) (*ListingPage, error) {
+	if n < 1 {
+		n = 1
+	}
+	doc, err := c.fetchDocument(ctx, l.URL(n))
+	if err != nil {
+		return nil, err
+	}
+	page, err := c.parser.Listing(doc, strings.TrimPrefix(l.Path, "/"))
+	if page != nil && page.Page == 0 {
+		page.Page = n
+	}
+	return page, err
+}
+
+// Walk calls fn with every page of a listing in order, starting from the
+// first, until the last page, an error, or ctx is done. An error returned
+// by fn stops the walk and is returned as is.
+func (c *Client) Walk(ctx context.Context, l Listing, fn func(*ListingPage) error) error {
+	for n := 1; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := c.Browse(ctx, l, n)
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if !page.HasNext || len(page.Mangas) == 0 {
+			return nil
+		}
+	}
+}
+
+// Listing parses a listing page: its cards and pagination. Pages with a
+// single page of results have no pagination, which isn't an error.
+func (p *Parser) Listing(doc *goquery.Document, page string) (*ListingPage, error) {
+	d := newDiag(page)
+	lp := &ListingPage{Mangas: p.cards(d, doc.Selection, 0)}
+	pag := p.find(d, doc.Selection, "pagination")
+	if pag.Length() > 0 {
+		lp.Page, _ = strconv.Atoi(cleanText(p.find(d, pag, "pagination.current").First().Text()))
+		lp.HasNext = p.find(d, pag, "pagination.next").Length() > 0
+		lp.LastPage = pageParam(p.find(d, pag, "pagination.last").First().AttrOr("href", ""))
+	}
+	if lp.LastPage == 0 && !lp.HasNext {
+		lp.LastPage = lp.Page
+	}
+	if lp.Mangas == nil {
+		lp.Mangas = []Manga{}
+	}
+	return lp, d.err()
+}
+
+// pageParam returns the page query parameter of href, or 0.
+func pageParam(href string) int {
+	u, err := url.Parse(href)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(u.Query().Get("page"))
+	return n
+}
+
+// categorySlug turns a category name into its URL slug: "Boys Love"
+// becomes "boys-love".
+func categorySlug(name string) string {
+	return url.PathEscape(strings.Join(strings.Fields(strings.ToLower(name)), "-"))
+}
@@ -0,0 +1,101 @@
+package mfire
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestListingURL(t *testing.T) {
+	tests := []struct {
+		l    Listing
+		n    int
+		want string
+	}{
+		{GenreListing("Boys Love"), 1, "https://mangafire.to/genre/boys-love"},
+		{GenreListing("action"), 3, "https://mangafire.to/genre/action?page=3"},
+		{TypeListing("One_Shot"), 2, "https://mangafire.to/type/one_shot?page=2"},
+		{AZListing("b"), 1, "https://mangafire.to/az-list/B"},
+		{AZListing(""), 0, "https://mangafire.to/az-list"},
+		{ListingUpdated, 5, "https://mangafire.to/updated?page=5"},
+	}
+	for _, tt := range tests {
+		if got := tt.l.URL(tt.n); got != tt.want {
+			t.Errorf("%+v.URL(%d) = %q, want %q", tt.l, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestParserListing(t *testing.T) {
+	// corpus: a first page of search results, with more to follow
+	lp, err := NewParser(nil).Listing(loadFixture(t, "filter.html"), "filter.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lp.Mangas) == 0 || lp.Page != 1 || lp.LastPage < 2 || !lp.HasNext {
+		t.Errorf("filter.html: got %d mangas, page %d/%d, next %v", len(lp.Mangas), lp.Page, lp.LastPage, lp.HasNext)
+	}
+	for _, m := range lp.Mangas {
+		checkManga(t, "filter.html", m)
+	}
+
+	tests := []struct {
+		fixture  string
+		mangas   int
+		page     int
+		lastPage int
+		hasNext  bool
+	}{
+		// hand-written: the last page of a genre, whose pagination has
+		// no rel=last link
+		{"genre.html", 2, 212, 212, false},
+		{"filter_empty.html", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		lp, err := NewParser(nil).Listing(loadFixture(t, tt.fixture), tt.fixture)
+		if err != nil {
+			t.Errorf("%s: %v", tt.fixture, err)
+			continue
+		}
+		if len(lp.Mangas) != tt.mangas || lp.Page != tt.page || lp.LastPage != tt.lastPage || lp.HasNext != tt.hasNext {
+			t.Errorf("%s: got %d mangas, page %d/%d, next %v; want %d, %d/%d, %v", tt.fixture,
+				len(lp.Mangas), lp.Page, lp.LastPage, lp.HasNext, tt.mangas, tt.page, tt.lastPage, tt.hasNext)
+		}
+	}
+}
+
+func TestClientWalk(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html"}}
+	c := NewClient(WithTransport(NewReplayTransport(&Cassette{Interactions: []Interaction{
+		{
+			Request:  RecordedRequest{Method: "GET", URL: "https://mangafire.to/genre/action"},
+			Response: RecordedResponse{Status: 200, Header: html, Body: readFixture(t, "filter.html")},
+		},
+		{
+			Request:  RecordedRequest{Method: "GET", URL: "https://mangafire.to/genre/action?page=2"},
+			Response: RecordedResponse{Status: 200, Header: html, Body: readFixture(t, "genre.html")},
+		},
+	}})))
+
+	var titles []string
+	err := c.Walk(context.Background(), GenreListing("Action"), func(lp *ListingPage) error {
+		for _, m := range lp.Mangas {
+			titles = append(titles, m.Title)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second page is the hand-written genre.html
+	if n := len(titles); n < 3 || titles[n-2] != "Kagurabachi" {
+		t.Errorf("titles = %q", titles)
+	}
+
+	stop := errors.New("stop")
+	err = c.Walk(context.Background(), GenreListing("action"), func(*ListingPage) error { return stop })
+	if err != stop {
+		t.Errorf("err = %v, want the callback's error", err)
+	}
+}
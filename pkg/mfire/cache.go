@@ -0,0 +1,315 @@
+package mfire
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStore stores serialised HTTP responses for CacheTransport. Stores
+// must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+	Delete(key string)
+}
+
+// CacheTransport is an http.RoundTripper that caches GET responses keyed by
+// URL. It honours Cache-Control (max-age, no-cache, no-store) and Expires,
+// revalidates stale entries with If-None-Match / If-Modified-Since, and can
+// enforce a minimum lifetime for sites that mark every page uncacheable.
+// Set-Cookie headers are never stored so cached hits don't replay cookies.
+// Vary is ignored: requests differing only in their headers share an
+// entry, so every request should carry the same header profile.
+type CacheTransport struct {
+	Base  http.RoundTripper
+	Store CacheStore
+	// MinTTL is the minimum time a stored response is served without
+	// revalidation, regardless of what the server's headers say: it
+	// overrides max-age, Expires, no-cache and private. Responses marked
+	// no-store are still never cached.
+	MinTTL time.Duration
+}
+
+const (
+	cachedAtHeader = "X-Mfire-Cached-At"
+	// XFromCache is set to "1" on responses served from the cache.
+	XFromCache = "X-From-Cache"
+)
+
+// RoundTrip implements http.RoundTripper.
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		hasDirective(req.Header, "no-store") || bypassCache(req.Context()) {
+		return base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	cached, storedAt := t.load(key, req)
+	if cached != nil && !hasDirective(req.Header, "no-cache") &&
+		time.Since(storedAt) < t.lifetime(cached.Header) {
+		cached.Header.Set(XFromCache, "1")
+		return cached, nil
+	}
+
+	if cached != nil {
+		etag := cached.Header.Get("ETag")
+		lastMod := cached.Header.Get("Last-Modified")
+		if etag != "" || lastMod != "" {
+			req = req.Clone(req.Context())
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastMod != "" {
+				req.Header.Set("If-Modified-Since", lastMod)
+			}
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		// refresh validators and freshness info from the 304
+		for _, h := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if v := resp.Header.Get(h); v != "" {
+				cached.Header.Set(h, v)
+			}
+		}
+		body, err := io.ReadAll(cached.Body)
+		cached.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.store(key, cached, body)
+		cached.Body = io.NopCloser(bytes.NewReader(body))
+		cached.Header.Set(XFromCache, "1")
+		return cached, nil
+	}
+
+	if resp.StatusCode != http.StatusOK || hasDirective(resp.Header, "no-store") {
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+			t.Store.Delete(key)
+		}
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.store(key, resp, body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+type noCacheCtxKey struct{}
+
+// withoutCache marks ctx so CacheTransport passes requests made with it
+// straight through, without sending a Cache-Control header the site could
+// treat differently.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheCtxKey{}, true)
+}
+
+func bypassCache(ctx context.Context) bool {
+	skip, _ := ctx.Value(noCacheCtxKey{}).(bool)
+	return skip
+}
+
+// lifetime returns how long a response stays fresh.
+func (t *CacheTransport) lifetime(h http.Header) time.Duration {
+	var ttl time.Duration
+	if !hasDirective(h, "no-cache") {
+		if v, ok := directiveValue(h, "max-age"); ok {
+			if secs, err := strconv.Atoi(v); err == nil {
+				ttl = time.Duration(secs) * time.Second
+			}
+		} else if exp, err := http.ParseTime(h.Get("Expires")); err == nil {
+			date, derr := http.ParseTime(h.Get("Date"))
+			if derr != nil {
+				date, _ = time.Parse(time.RFC3339Nano, h.Get(cachedAtHeader))
+			}
+			ttl = exp.Sub(date)
+		}
+	}
+	if ttl < t.MinTTL {
+		ttl = t.MinTTL
+	}
+	return ttl
+}
+
+// store serialises resp with the given body into the store.
+func (t *CacheTransport) store(key string, resp *http.Response, body []byte) {
+	saved := *resp
+	saved.Header = resp.Header.Clone()
+	saved.Header.Del("Set-Cookie")
+	saved.Header.Del(XFromCache)
+	saved.Header.Set(cachedAtHeader, time.Now().UTC().Format(time.RFC3339Nano))
+	// the body is stored in full, so frame it with a plain Content-Length
+	saved.TransferEncoding = nil
+	saved.ContentLength = int64(len(body))
+	saved.Body = io.NopCloser(bytes.NewReader(body))
+	data, err := httputil.DumpResponse(&saved, true)
+	if err != nil {
+		return
+	}
+	t.Store.Set(key, data)
+}
+
+// load returns the stored response for key and when it was stored.
+func (t *CacheTransport) load(key string, req *http.Request) (*http.Response, time.Time) {
+	data, ok := t.Store.Get(key)
+	if !ok {
+		return nil, time.Time{}
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		t.Store.Delete(key)
+		return nil, time.Time{}
+	}
+	storedAt, err := time.Parse(time.RFC3339Nano, resp.Header.Get(cachedAtHeader))
+	if err != nil {
+		t.Store.Delete(key)
+		return nil, time.Time{}
+	}
+	return resp, storedAt
+}
+
+func hasDirective(h http.Header, name string) bool {
+	_, ok := directiveValue(h, name)
+	return ok
+}
+
+// directiveValue looks up a Cache-Control (or Pragma no-cache) directive.
+func directiveValue(h http.Header, name string) (string, bool) {
+	for _, cc := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(cc, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(k, name) {
+				return strings.Trim(v, `"`), true
+			}
+		}
+	}
+	if name == "no-cache" && strings.EqualFold(h.Get("Pragma"), "no-cache") && h.Get("Cache-Control") == "" {
+		return "", true
+	}
+	return "", false
+}
+
+// MemoryCache is an in-memory LRU CacheStore. It's safe for concurrent use.
+type MemoryCache struct {
+	mu       sync.Mutex
+	ll       *list.List
+	items    map[string]*list.Element
+	capacity int
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// NewMemoryCache returns an LRU store holding at most capacity responses.
+func NewMemoryCache(capacity int) *MemoryCache {
+	if capacity <= 0 {
+		capacity = 256
+	}
+	return &MemoryCache{ll: list.New(), items: make(map[string]*list.Element), capacity: capacity}
+}
+
+// Get implements CacheStore.
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.ll.MoveToFront(el)
+	return el.Value.(*memoryEntry).data, true
+}
+
+// Set implements CacheStore.
+func (m *MemoryCache) Set(key string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryEntry).data = data
+		m.ll.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.ll.PushFront(&memoryEntry{key: key, data: data})
+	if m.ll.Len() > m.capacity {
+		tail := m.ll.Back()
+		m.ll.Remove(tail)
+		delete(m.items, tail.Value.(*memoryEntry).key)
+	}
+}
+
+// Delete implements CacheStore.
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.ll.Remove(el)
+		delete(m.items, key)
+	}
+}
+
+// DiskCache is a CacheStore that keeps one file per response in a directory.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a store rooted at dir, creating it if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get implements CacheStore.
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set implements CacheStore. Writes are atomic; errors are ignored since a
+// failed write only costs a future cache miss.
+func (d *DiskCache) Set(key string, data []byte) {
+	_ = writeFileAtomic(d.path(key), data, 0o644)
+}
+
+// Delete implements CacheStore.
+func (d *DiskCache) Delete(key string) {
+	_ = os.Remove(d.path(key))
+}
@@ -0,0 +1,180 @@
+package mfire
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cacheOrigin is a fake site for CacheTransport: each path answers with
+// its headers, a body counting the requests made for it, and 304 when the
+// request's If-None-Match matches the ETag.
+type cacheOrigin struct {
+	headers map[string]http.Header
+	hits    map[string]int
+	cond    map[string]int // conditional requests
+}
+
+func (o *cacheOrigin) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := req.URL.Path
+	o.hits[path]++
+	h := o.headers[path].Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	code := http.StatusOK
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		o.cond[path]++
+		if etag := h.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == etag {
+			code = http.StatusNotModified
+		}
+	}
+	if path == "/gone" {
+		code = http.StatusNotFound
+	}
+	body := ""
+	if code == http.StatusOK {
+		body = path + "#" + strconv.Itoa(o.hits[path])
+	}
+	return &http.Response{StatusCode: code, Status: http.StatusText(code), Header: h,
+		Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func TestCacheTransport(t *testing.T) {
+	stale := http.TimeFormat
+	tests := []struct {
+		name    string
+		headers http.Header
+		minTTL  time.Duration
+		req     http.Header
+		bypass  bool
+		// wants are the bodies of three requests for the same URL
+		want []string
+		cond int
+	}{
+		{"max-age", http.Header{"Cache-Control": {"max-age=60"}}, 0, nil, false,
+			[]string{"#1", "#1", "#1"}, 0},
+		{"expires", http.Header{"Expires": {time.Now().Add(time.Hour).UTC().Format(stale)}, "Date": {time.Now().UTC().Format(stale)}}, 0, nil, false,
+			[]string{"#1", "#1", "#1"}, 0},
+		{"uncacheable", nil, 0, nil, false,
+			[]string{"#1", "#2", "#3"}, 0},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, time.Hour, nil, false,
+			[]string{"#1", "#2", "#3"}, 0},
+		{"min ttl", http.Header{"Cache-Control": {"no-cache, private"}}, time.Hour, nil, false,
+			[]string{"#1", "#1", "#1"}, 0},
+		{"revalidated", http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}, 0, nil, false,
+			[]string{"#1", "#1", "#1"}, 2},
+		{"changed", http.Header{"Cache-Control": {"max-age=0"}, "Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, 0, nil, false,
+			[]string{"#1", "#2", "#3"}, 2},
+		{"request no-cache", http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}}, 0, http.Header{"Cache-Control": {"no-cache"}}, false,
+			[]string{"#1", "#1", "#1"}, 2},
+		{"range", http.Header{"Cache-Control": {"max-age=60"}}, 0, http.Header{"Range": {"bytes=0-1"}}, false,
+			[]string{"#1", "#2", "#3"}, 0},
+		{"bypassed", http.Header{"Cache-Control": {"max-age=60"}}, 0, nil, true,
+			[]string{"#1", "#2", "#3"}, 0},
+	}
+	for _, tt := range tests {
+		origin := &cacheOrigin{headers: map[string]http.Header{"/page": tt.headers}, hits: map[string]int{}, cond: map[string]int{}}
+		c := &http.Client{Transport: &CacheTransport{Base: origin, Store: NewMemoryCache(0), MinTTL: tt.minTTL}}
+		for i, want := range tt.want {
+			ctx := context.Background()
+			if tt.bypass {
+				ctx = withoutCache(ctx)
+			}
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://mangafire.to/page", nil)
+			for k, v := range tt.req {
+				req.Header[k] = v
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if got := strings.TrimPrefix(string(body), "/page"); got != want || resp.StatusCode != 200 {
+				t.Errorf("%s: request %d = %d %q, want %q", tt.name, i+1, resp.StatusCode, got, want)
+			}
+			if fromCache := resp.Header.Get(XFromCache) == "1"; fromCache != (i > 0 && want == "#1") {
+				t.Errorf("%s: request %d %s = %v", tt.name, i+1, XFromCache, fromCache)
+			}
+		}
+		if origin.cond["/page"] != tt.cond {
+			t.Errorf("%s: %d conditional requests, want %d", tt.name, origin.cond["/page"], tt.cond)
+		}
+	}
+}
+
+func TestCacheTransportStore(t *testing.T) {
+	origin := &cacheOrigin{
+		headers: map[string]http.Header{
+			"/login": {"Cache-Control": {"max-age=60"}, "Set-Cookie": {"session=1"}},
+		},
+		hits: map[string]int{}, cond: map[string]int{},
+	}
+	store := NewMemoryCache(2)
+	c := &http.Client{Transport: &CacheTransport{Base: origin, Store: store, MinTTL: time.Hour}}
+	get := func(path string) (string, *http.Response) {
+		resp, err := c.Get("https://mangafire.to" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp
+	}
+
+	if _, resp := get("/login"); len(resp.Cookies()) != 1 {
+		t.Error("Set-Cookie dropped from the live response")
+	}
+	if body, resp := get("/login"); body != "/login#1" || len(resp.Cookies()) != 0 {
+		t.Errorf("cached hit = %q with cookies %v", body, resp.Cookies())
+	}
+
+	// the store holds two entries; using /a keeps it over /b
+	get("/a")
+	get("/b")
+	get("/a")
+	get("/c")
+	for _, want := range []string{"/a#1", "/c#1", "/b#2"} {
+		path, _, _ := strings.Cut(want, "#")
+		if body, _ := get(path); body != want {
+			t.Errorf("%s = %q, want %q", path, body, want)
+		}
+	}
+	if _, ok := store.Get("https://mangafire.to/login"); ok {
+		t.Error("least recently used entry kept")
+	}
+
+	// a 404 drops the stored copy
+	store.Set("https://mangafire.to/gone", []byte("HTTP/1.1 200 OK\r\n\r\n"))
+	if _, resp := get("/gone"); resp.StatusCode != 404 {
+		t.Errorf("/gone = %d", resp.StatusCode)
+	}
+	if _, ok := store.Get("https://mangafire.to/gone"); ok {
+		t.Error("404 left the stale entry")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		d.Set(fmt.Sprint("key", i), []byte(fmt.Sprint("value", i)))
+	}
+	d.Delete("key1")
+	d, _ = NewDiskCache(dir)
+	for i, want := range []string{"value0", "", "value2"} {
+		data, ok := d.Get(fmt.Sprint("key", i))
+		if string(data) != want || ok != (want != "") {
+			t.Errorf("key%d = %q, %v", i, data, ok)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package mfire
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNotRecorded is returned by ReplayTransport for requests that have no
+// recorded response.
+var ErrNotRecorded = errors.New("mfire: request not in cassette")
+
+// Cassette is a recorded sequence of HTTP interactions, stored as JSON.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the normalised form of a recorded request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// RecordedResponse is a recorded response. Bodies that aren't valid UTF-8
+// (images) are stored base64-encoded.
+type RecordedResponse struct {
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// vrfPlaceholder replaces vrf tokens in recorded URLs, so a cassette matches
+// whatever token the client computes on replay.
+const vrfPlaceholder = "VRF"
+
+// volatileHeaders are dropped from recordings: cookies would leak the
+// session into the cassette, and the rest change on every request.
+var volatileHeaders = []string{"Cookie", "Set-Cookie", "Date", "Cf-Ray", "Report-To", "Nel", "Age"}
+
+// normalizeURL canonicalises a request URL for matching: the vrf parameter
+// is replaced with a placeholder and query parameters are sorted.
+func normalizeURL(u *url.URL) string {
+	n := *u
+	q := n.Query()
+	if q.Has("vrf") {
+		q.Set("vrf", vrfPlaceholder)
+	}
+	n.RawQuery = q.Encode()
+	n.Fragment = ""
+	return n.String()
+}
+
+func interactionKey(method, normalizedURL string) string {
+	return method + " " + normalizedURL
+}
+
+func stripHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range volatileHeaders {
+		h.Del(name)
+	}
+	return h
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("load cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path atomically.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0o644)
+}
+
+// RecordingTransport forwards requests to Base and appends every
+// interaction to a cassette file, which it starts afresh. Each interaction
+// is appended in place, so the file is a usable cassette after every
+// request and an interrupted run keeps what it recorded. It is safe for
+// concurrent use.
+type RecordingTransport struct {
+	Base http.RoundTripper
+	Path string
+
+	mu      sync.Mutex
+	started bool // the file holds this run's cassette
+}
+
+// cassetteTail closes the interaction list of a cassette being recorded;
+// each new interaction is written over it.
+const cassetteTail = "\n]}\n"
+
+// NewRecordingTransport returns a transport recording to path. A nil base
+// uses http.DefaultTransport; WithRecorder sets the base to the transport
+// the Client would otherwise use.
+func NewRecordingTransport(path string, base http.RoundTripper) *RecordingTransport {
+	return &RecordingTransport{Base: base, Path: path}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := RecordedResponse{Status: resp.StatusCode, Header: stripHeaders(resp.Header)}
+	if utf8.Valid(body) {
+		rec.Body = string(body)
+	} else {
+		rec.Body = base64.StdEncoding.EncodeToString(body)
+		rec.BodyEncoding = "base64"
+	}
+	in := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    normalizeURL(req.URL),
+			Header: stripHeaders(req.Header),
+		},
+		Response: rec,
+	}
+
+	if err := t.append(in); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("record %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
+
+// append adds in to the cassette file, creating it on the first call.
+func (t *RecordingTransport) append(in Interaction) error {
+	data, err := json.MarshalIndent(in, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.started {
+		head := "{\n\"interactions\": [\n  "
+		if err := writeFileAtomic(t.Path, []byte(head+string(data)+cassetteTail), 0o644); err != nil {
+			return err
+		}
+		t.started = true
+		return nil
+	}
+	f, err := os.OpenFile(t.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	entry := append(append([]byte(",\n  "), data...), cassetteTail...)
+	if _, err := f.WriteAt(entry, fi.Size()-int64(len(cassetteTail))); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReplayTransport serves responses from a cassette without touching the
+// network. Requests are matched on method and normalised URL; when the same
+// request was recorded several times the responses are replayed in order,
+// the last one repeating. It is safe for concurrent use.
+type ReplayTransport struct {
+	mu    sync.Mutex
+	byKey map[string][]RecordedResponse
+	next  map[string]int
+}
+
+// NewReplayTransport returns a transport replaying c.
+func NewReplayTransport(c *Cassette) *ReplayTransport {
+	t := &ReplayTransport{byKey: make(map[string][]RecordedResponse), next: make(map[string]int)}
+	for _, in := range c.Interactions {
+		u, err := url.Parse(in.Request.URL)
+		if err != nil {
+			continue
+		}
+		key := interactionKey(in.Request.Method, normalizeURL(u))
+		t.byKey[key] = append(t.byKey[key], in.Response)
+	}
+	return t
+}
+
+// LoadReplayTransport reads the cassette at path and returns a transport
+// replaying it.
+func LoadReplayTransport(path string) (*ReplayTransport, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayTransport(c), nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := interactionKey(req.Method, normalizeURL(req.URL))
+	t.mu.Lock()
+	recs := t.byKey[key]
+	if len(recs) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+	i := t.next[key]
+	if i < len(recs)-1 {
+		t.next[key] = i + 1
+	}
+	rec := recs[i]
+	t.mu.Unlock()
+
+	body := []byte(rec.Body)
+	if rec.BodyEncoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(rec.Body); err != nil {
+			return nil, fmt.Errorf("replay %s: %w", key, err)
+		}
+	}
+	header := rec.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Del("Content-Encoding")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package mfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "page "+r.URL.Query().Get("keyword"))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := NewRecordingTransport(path, nil)
+	req, _ := http.NewRequest("GET", srv.URL+"/filter?keyword=x&vrf=token-one", nil)
+	req.Header.Set("Cookie", "session=secret")
+	resp, err := rec.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "token-one") {
+		t.Errorf("cassette leaks cookies or vrf:\n%s", data)
+	}
+
+	replay, err := LoadReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a different vrf for the same query still matches
+	resp, err = (&http.Client{Transport: replay}).Get(srv.URL + "/filter?vrf=token-two&keyword=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "page x" {
+		t.Errorf("replayed body = %q", body)
+	}
+	if hits != 1 {
+		t.Errorf("server hit %d times, want 1", hits)
+	}
+
+	_, err = replay.RoundTrip(httptest.NewRequest("GET", srv.URL+"/home", nil))
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("err = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestClientWithRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	os.WriteFile(path, []byte("an older recording"), 0o644)
+	pages := 0
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		pages++
+		return &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader(fmt.Sprint("page ", pages))), Request: req}, nil
+	})
+	rec := NewRecordingTransport(path, nil)
+	c := NewClient(WithTransport(rt), WithRecorder(rec))
+	for i := 1; i <= 3; i++ {
+		if _, err := c.fetchBody(context.Background(), fmt.Sprint("https://mangafire.to/page/", i), ""); err != nil {
+			t.Fatal(err)
+		}
+		// the file is a complete cassette after every request
+		cassette, err := LoadCassette(path)
+		if err != nil {
+			t.Fatalf("after request %d: %v", i, err)
+		}
+		if n := len(cassette.Interactions); n != i || cassette.Interactions[i-1].Response.Body != fmt.Sprint("page ", i) {
+			t.Errorf("after request %d: %d interactions %+v", i, n, cassette.Interactions)
+		}
+	}
+
+	// without WithTransport, the recorder wraps the proxied transport
+	proxy, _ := ParseProxyURL("127.0.0.1:8080")
+	rec = NewRecordingTransport(path, nil)
+	NewClient(WithProxy(proxy), WithRecorder(rec))
+	tr, ok := rec.Base.(*orderedTransport)
+	if !ok {
+		t.Fatalf("recorder base = %#v, want the Client's transport", rec.Base)
+	}
+	req, _ := http.NewRequest("GET", "https://mangafire.to/", nil)
+	if u, _ := tr.proxy(req); u == nil || u.Host != "127.0.0.1:8080" {
+		t.Errorf("recorder base proxies through %v, want 127.0.0.1:8080", u)
+	}
+}
+
+func TestClientWithReplayTransport(t *testing.T) {
+	home, err := os.ReadFile(filepath.Join("testdata", "home.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(WithTransport(NewReplayTransport(&Cassette{Interactions: []Interaction{{
+		Request:  RecordedRequest{Method: "GET", URL: "https://mangafire.to/home"},
+		Response: RecordedResponse{Status: 200, Header: http.Header{"Content-Type": {"text/html"}}, Body: string(home)},
+	}}})))
+	mangas, err := c.FetchHome(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mangas) == 0 || len(mangas) > 10 {
+		t.Errorf("got %d mangas, want 1 to 10", len(mangas))
+	}
+}
@@ -0,0 +1,187 @@
+package mfire
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ComicInfo is the ComicInfo.xml metadata (schema v2.0) read by Komga,
+// Kavita, Tachiyomi and most other comic servers. Empty fields are left
+// out.
+type ComicInfo struct {
+	XMLName     xml.Name        `xml:"ComicInfo"`
+	Title       string          `xml:"Title,omitempty"`
+	Series      string          `xml:"Series,omitempty"`
+	Number      string          `xml:"Number,omitempty"`
+	Volume      int             `xml:"Volume,omitempty"`
+	Summary     string          `xml:"Summary,omitempty"`
+	Year        int             `xml:"Year,omitempty"`
+	Month       int             `xml:"Month,omitempty"`
+	Day         int             `xml:"Day,omitempty"`
+	Writer      string          `xml:"Writer,omitempty"`
+	Genre       string          `xml:"Genre,omitempty"`
+	Web         string          `xml:"Web,omitempty"`
+	PageCount   int             `xml:"PageCount,omitempty"`
+	LanguageISO string          `xml:"LanguageISO,omitempty"`
+	Manga       string          `xml:"Manga,omitempty"` // "Yes" or "YesAndRightToLeft"
+	Pages       []ComicInfoPage `xml:"Pages>Page,omitempty"`
+}
+
+// ComicInfoPage describes one image of the archive.
+type ComicInfoPage struct {
+	Image    int    `xml:"Image,attr"`
+	Type     string `xml:"Type,attr,omitempty"` // "FrontCover" for the first page
+	Bookmark string `xml:"Bookmark,attr,omitempty"`
+}
+
+// NewComicInfo builds the metadata of chapter ch of a manga. details may be
+// nil, leaving the series fields empty. PageCount and Pages are filled in
+// by WriteCBZ. A chapter of kind "volume" gets a Volume and no Number.
+func NewComicInfo(details *Details, ch Chapter) *ComicInfo {
+	info := &ComicInfo{
+		Title:       ch.Title,
+		Number:      FormatNumber(ch.Number),
+		Volume:      int(ch.Volume),
+		Web:         ch.Url,
+		LanguageISO: ch.Language.ISO(),
+	}
+	if ch.Kind == "volume" {
+		info.Number = ""
+	}
+	if !ch.Date.IsZero() {
+		info.Year, info.Month, info.Day = ch.Date.Year(), int(ch.Date.Month()), ch.Date.Day()
+	}
+	if details != nil {
+		info.Series = details.Title
+		info.Summary = details.Description
+		info.Writer = strings.Join(details.Authors, ", ")
+		info.Genre = strings.Join(details.Genres, ", ")
+		if info.Web == "" {
+			info.Web = details.Url
+		}
+		info.Manga = "Yes"
+		if details.RightToLeft() {
+			info.Manga = "YesAndRightToLeft"
+		}
+	}
+	return info
+}
+
+// WriteCBZ packs the page images in files, in order, into a CBZ archive at
+// path, with info (when non-nil) as its ComicInfo.xml. The archive is
+// written to a temporary file and renamed into place, so an interrupted
+// run never leaves a truncated archive behind. info's Pages are kept when
+// there is one per file, and generated otherwise.
+func WriteCBZ(path string, files []string, info *ComicInfo) error {
+	if info != nil {
+		ci := *info
+		ci.PageCount = len(files)
+		if len(ci.Pages) != len(files) {
+			ci.Pages = make([]ComicInfoPage, len(files))
+			for i := range files {
+				ci.Pages[i] = ComicInfoPage{Image: i}
+			}
+			if len(files) > 0 {
+				ci.Pages[0].Type = "FrontCover"
+			}
+		}
+		info = &ci
+	}
+	return writeAtomic(path, 0o644, func(w io.Writer) error {
+		zw := zip.NewWriter(w)
+		if info != nil {
+			f, err := zw.Create("ComicInfo.xml")
+			if err != nil {
+				return err
+			}
+			io.WriteString(f, xml.Header)
+			enc := xml.NewEncoder(f)
+			enc.Indent("", "  ")
+			if err := enc.Encode(info); err != nil {
+				return err
+			}
+		}
+		for i, file := range files {
+			if err := addStored(zw, cbzEntryName(i, len(files), file), file); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	})
+}
+
+// addStored copies file into zw uncompressed; images don't compress.
+func addStored(zw *zip.Writer, name, file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	hdr.Name, hdr.Method = name, zip.Store
+	dst, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// cbzEntryName names page i of n so that readers sorting entries by name
+// keep the page order, whatever the source files are called.
+func cbzEntryName(i, n int, file string) string {
+	width := len(strconv.Itoa(n))
+	if width < 3 {
+		width = 3
+	}
+	num := strconv.Itoa(i + 1)
+	return strings.Repeat("0", width-len(num)) + num + strings.ToLower(filepath.Ext(file))
+}
+
+// DownloadCBZ downloads ch and packs it into a CBZ archive at path, with
+// metadata from details (which may be nil).
+func (d *Downloader) DownloadCBZ(ctx context.Context, ch Chapter, details *Details, path string) error {
+	return d.downloadExport(ctx, []Chapter{ch}, details, path, func(export []ExportChapter) error {
+		return WriteCBZ(path, export[0].Files, NewComicInfo(details, ch))
+	})
+}
+
+// DownloadVolumeCBZ downloads the chapters of vol and packs them into one
+// CBZ archive at path, with the first page of each chapter bookmarked
+// with its title. details may be nil.
+func (d *Downloader) DownloadVolumeCBZ(ctx context.Context, vol VolumeGroup, details *Details, path string) error {
+	return d.downloadExport(ctx, vol.Chapters, details, path, func(export []ExportChapter) error {
+		info := NewComicInfo(details, vol.Chapter())
+		var files []string
+		for _, ec := range export {
+			for i, f := range ec.Files {
+				page := ComicInfoPage{Image: len(files)}
+				if i == 0 {
+					page.Bookmark = ec.Chapter.Title
+					if page.Bookmark == "" {
+						page.Bookmark = "Chapter " + FormatNumber(ec.Chapter.Number)
+					}
+				}
+				info.Pages = append(info.Pages, page)
+				files = append(files, f)
+			}
+		}
+		if len(info.Pages) > 0 {
+			info.Pages[0].Type = "FrontCover"
+		}
+		return WriteCBZ(path, files, info)
+	})
+}
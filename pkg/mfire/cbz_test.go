@@ -0,0 +1,187 @@
+package mfire
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLanguageISO(t *testing.T) {
+	for l, want := range map[Language]string{English: "en", SpanishLatAm: "es-419", PortugueseBrazil: "pt-BR", "zh-hk": "zh-HK"} {
+		if got := l.ISO(); got != want {
+			t.Errorf("%q.ISO() = %q, want %q", l, got, want)
+		}
+	}
+}
+
+func TestWriteCBZ(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"p1.JPG", "p2.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("image "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	details := &Details{
+		Title: "One Piece", Type: "Manga", Url: "https://mangafire.to/manga/one-piecee.dkw",
+		Authors: []string{"Oda Eiichiro"}, Genres: []string{"Action", "Adventure"}, Description: "Pirates.",
+	}
+	ch := Chapter{
+		Number: 1097.5, Title: "Chapter 1097.5: Extra", Language: SpanishLatAm,
+		Date: time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC),
+		Url:  "https://mangafire.to/read/one-piecee.dkw/es-la/chapter-1097.5",
+	}
+	path := filepath.Join(dir, "out", "c1097.5.cbz")
+	if err := WriteCBZ(path, files, NewComicInfo(details, ch)); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	var info ComicInfo
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		switch f.Name {
+		case "ComicInfo.xml":
+			if err := xml.Unmarshal(data, &info); err != nil {
+				t.Fatal(err)
+			}
+		case "001.jpg":
+			if string(data) != "image p1.JPG" {
+				t.Errorf("001.jpg = %q", data)
+			}
+		}
+	}
+	if want := []string{"ComicInfo.xml", "001.jpg", "002.png"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %q, want %q", names, want)
+	}
+	want := ComicInfo{
+		XMLName: xml.Name{Local: "ComicInfo"},
+		Title:   "Chapter 1097.5: Extra", Series: "One Piece", Number: "1097.5", Summary: "Pirates.",
+		Year: 2023, Month: 11, Day: 20, Writer: "Oda Eiichiro", Genre: "Action, Adventure",
+		Web: ch.Url, PageCount: 2, LanguageISO: "es-419", Manga: "YesAndRightToLeft",
+		Pages: []ComicInfoPage{{Image: 0, Type: "FrontCover"}, {Image: 1}},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("ComicInfo = %+v\nwant %+v", info, want)
+	}
+
+	// a failed write leaves the existing archive alone and no temp files
+	if err := WriteCBZ(path, []string{filepath.Join(dir, "missing.jpg")}, nil); err == nil {
+		t.Fatal("WriteCBZ with a missing page succeeded")
+	}
+	if _, err := zip.OpenReader(path); err != nil {
+		t.Errorf("existing archive damaged: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temp file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestDownloadVolumeCBZ(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, gradient(20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	// chapters have as many pages as their ID says; the reader endpoint's
+	// kind must match the chapter's
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := img.Bytes()
+		if req.URL.Host != "img.test" {
+			kind, id := path.Split(strings.TrimPrefix(req.URL.Path, "/ajax/read/"))
+			n, _ := strconv.Atoi(id)
+			if kind != "chapter/" && !(kind == "volume/" && id == "3") {
+				n = 0
+			}
+			var images []string
+			for i := 0; i < n; i++ {
+				images = append(images, fmt.Sprintf(`["https://img.test/%s/%d.png",1,0]`, id, i))
+			}
+			body = []byte(`{"status":200,"result":{"images":[` + strings.Join(images, ",") + `]}}`)
+		}
+		return &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{},
+			Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+	})
+	d := NewDownloader(NewClient(WithTransport(rt)))
+	details := &Details{Title: "One Piece"}
+	manga := MangaRef{ID: "dkw", Slug: "op"}
+	vol := VolumeGroup{Volume: 2, Chapters: []Chapter{
+		{ID: "2", Manga: manga, Number: 5, Title: "Chapter 5: Start"},
+		{ID: "3", Manga: manga, Number: 6},
+	}}
+	out := filepath.Join(t.TempDir(), "vol-2.cbz")
+	if err := d.DownloadVolumeCBZ(context.Background(), vol, details, out); err != nil {
+		t.Fatal(err)
+	}
+	info := readComicInfo(t, out)
+	if info.Volume != 2 || info.Number != "" || info.Title != "Vol. 2" || info.PageCount != 5 {
+		t.Errorf("ComicInfo = %+v", info)
+	}
+	want := []ComicInfoPage{{Image: 0, Type: "FrontCover", Bookmark: "Chapter 5: Start"}, {Image: 1}, {Image: 2, Bookmark: "Chapter 6"}, {Image: 3}, {Image: 4}}
+	if !reflect.DeepEqual(info.Pages, want) {
+		t.Errorf("pages = %+v, want %+v", info.Pages, want)
+	}
+
+	// a volume the site offers as a whole is fetched as one
+	whole := VolumeGroup{Volume: 3, Chapters: []Chapter{{ID: "3", Manga: manga, Kind: "volume", Number: 3, Volume: 3, Title: "Vol. 3"}}}
+	if err := d.DownloadVolumeCBZ(context.Background(), whole, details, out); err != nil {
+		t.Fatal(err)
+	}
+	if info := readComicInfo(t, out); info.Volume != 3 || info.PageCount != 3 || info.Pages[0].Bookmark != "Vol. 3" {
+		t.Errorf("ComicInfo = %+v", info)
+	}
+}
+
+// readComicInfo returns the ComicInfo.xml of the archive at path.
+func readComicInfo(t *testing.T, path string) ComicInfo {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var info ComicInfo
+	for _, f := range zr.File {
+		if f.Name != "ComicInfo.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = xml.NewDecoder(rc).Decode(&info)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return info
+}
@@ -0,0 +1,347 @@
+package mfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// ErrNoLanguage is returned when a manga has no chapters in any of the
+	// Client's preferred languages.
+	ErrNoLanguage = errors.New("mfire: no chapters in a preferred language")
+	// ErrChapterNotFound is returned when a requested chapter doesn't exist
+	// in any preferred language.
+	ErrChapterNotFound = errors.New("mfire: chapter not found")
+)
+
+// MangaLanguages returns the languages manga's chapters are available in.
+func (c *Client) MangaLanguages(ctx context.Context, manga MangaRef) ([]MangaLanguage, error) {
+	doc, err := c.fetchDocument(ctx, manga.URL())
+	if err != nil {
+		return nil, err
+	}
+	return c.parser.MangaLanguages(doc)
+}
+
+// Chapters lists manga's chapters in lang, newest first as the site orders
+// them. Two ajax requests are made: the reader's list carries the chapter
+// IDs needed for Pages, the detail page's list the release dates.
+func (c *Client) Chapters(ctx context.Context, manga MangaRef, lang Language) ([]Chapter, error) {
+	lang = ParseLanguage(string(lang))
+	list, err := c.fetchBody(ctx, "https://mangafire.to/ajax/manga/"+manga.ID+"/chapter/"+string(lang), manga.URL())
+	if err != nil {
+		return nil, fmt.Errorf("chapters %s/%s: %w", manga.ID, lang, err)
+	}
+	read, err := c.readList(ctx, manga, "chapter", lang)
+	if err != nil {
+		return nil, err
+	}
+	return c.parser.Chapters(manga, lang, list, read)
+}
+
+// Volumes lists the volumes manga offers as a whole in lang, newest first.
+// Many manga have none.
+func (c *Client) Volumes(ctx context.Context, manga MangaRef, lang Language) ([]Chapter, error) {
+	lang = ParseLanguage(string(lang))
+	read, err := c.readList(ctx, manga, "volume", lang)
+	if err != nil {
+		return nil, err
+	}
+	return c.parser.Chapters(manga, lang, nil, read)
+}
+
+// readList fetches the reader's list of manga's chapters or volumes.
+func (c *Client) readList(ctx context.Context, manga MangaRef, kind string, lang Language) ([]byte, error) {
+	vrf, err := GenerateVrf(manga.ID + "@" + kind + "@" + string(lang))
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.fetchBody(ctx, "https://mangafire.to/ajax/read/"+manga.ID+"/"+kind+"/"+string(lang)+"?vrf="+url.QueryEscape(vrf), manga.URL())
+	if err != nil {
+		return nil, fmt.Errorf("%ss %s/%s: %w", kind, manga.ID, lang, err)
+	}
+	return body, nil
+}
+
+// ChapterList lists manga's chapters in the best available language for
+// each, newest first. Available languages are ranked by the Client's
+// preferences (see WithLanguages), each preference matching exactly first
+// and then by regional variant. Every chapter comes from the highest-ranked
+// language that has it, so with preferences "es,en" a reader gets "es"
+// chapters where they exist, "es-la" ones filling the gaps and English
+// ones after that. Chapters only available in languages outside the
+// preferences are left out. Each chapter number is listed once; among
+// several uploads of it the Client's dedupe rules choose (see
+// WithDedupeRules).
+func (c *Client) ChapterList(ctx context.Context, manga MangaRef) ([]Chapter, error) {
+	groups, err := c.ChapterUploads(ctx, manga)
+	if err != nil {
+		return nil, err
+	}
+	return bestOf(groups), nil
+}
+
+// ChapterUploads lists every upload of manga's chapters in the preferred
+// languages, grouped by number, newest first, with the one ChapterList
+// keeps as each group's Best.
+func (c *Client) ChapterUploads(ctx context.Context, manga MangaRef) ([]ChapterGroup, error) {
+	all, ranked, err := c.uploads(ctx, manga, c.Chapters, true)
+	if err != nil {
+		return nil, err
+	}
+	groups := GroupChapters(all)
+	if err := c.pickBest(ctx, groups, DedupePolicy{Languages: ranked, Rules: c.dedupeRules}); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// VolumeList lists manga's volumes in the best available language for
+// each, newest first, like ChapterList does for chapters.
+func (c *Client) VolumeList(ctx context.Context, manga MangaRef) ([]Chapter, error) {
+	all, ranked, err := c.uploads(ctx, manga, c.Volumes, false)
+	if err != nil {
+		return nil, err
+	}
+	return c.Dedupe(ctx, all, DedupePolicy{Languages: ranked, Rules: c.dedupeRules})
+}
+
+// uploads runs list for each of manga's languages the Client prefers,
+// most preferred first, and returns everything listed along with the
+// ranked languages. required makes having none of them an error.
+func (c *Client) uploads(ctx context.Context, manga MangaRef, list func(context.Context, MangaRef, Language) ([]Chapter, error), required bool) ([]Chapter, []Language, error) {
+	available, err := c.MangaLanguages(ctx, manga)
+	if err != nil {
+		return nil, nil, err
+	}
+	codes := make([]Language, len(available))
+	for i, a := range available {
+		codes[i] = a.Language
+	}
+	ranked := rankLanguages(codes, c.Languages())
+	if len(ranked) == 0 && required {
+		return nil, nil, fmt.Errorf("%w: %s offers %v, want %v", ErrNoLanguage, manga.ID, codes, c.Languages())
+	}
+	var all []Chapter
+	for _, lang := range ranked {
+		chapters, err := list(ctx, manga, lang)
+		if err != nil {
+			return nil, nil, err
+		}
+		all = append(all, chapters...)
+	}
+	return all, ranked, nil
+}
+
+// ReadChapter finds chapter number of manga in the best available language
+// and returns it along with its pages. Numbers are compared to four decimal
+// places, as GroupChapters does.
+func (c *Client) ReadChapter(ctx context.Context, manga MangaRef, number float64) (Chapter, []Page, error) {
+	chapters, err := c.ChapterList(ctx, manga)
+	if err != nil {
+		return Chapter{}, nil, err
+	}
+	for _, ch := range chapters {
+		if normalizeNumber(ch.Number) == normalizeNumber(number) {
+			pages, err := c.Pages(ctx, ch)
+			return ch, pages, err
+		}
+	}
+	return Chapter{}, nil, fmt.Errorf("%w: %s chapter %s", ErrChapterNotFound, manga.ID, FormatNumber(number))
+}
+
+// FindChapter returns the chapter or volume a reader URL points at, in the
+// URL's language.
+func (c *Client) FindChapter(ctx context.Context, ref ReaderRef) (Chapter, error) {
+	list := c.Chapters
+	if ref.Kind == "volume" {
+		list = c.Volumes
+	}
+	chapters, err := list(ctx, ref.MangaRef, ref.Language)
+	if err != nil {
+		return Chapter{}, err
+	}
+	for _, ch := range chapters {
+		if ch.Number == ref.Number {
+			return ch, nil
+		}
+	}
+	return Chapter{}, fmt.Errorf("%w: %s %s %s %s", ErrChapterNotFound, ref.ID, ref.Language, ref.Kind, FormatNumber(ref.Number))
+}
+
+// Pages returns the images of ch in reading order.
+func (c *Client) Pages(ctx context.Context, ch Chapter) ([]Page, error) {
+	kind := ch.Kind
+	if kind == "" {
+		kind = "chapter"
+	}
+	vrf, err := GenerateVrf(kind + "@" + ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	referer := ch.Url
+	if referer == "" {
+		referer = ch.Manga.URL()
+	}
+	body, err := c.fetchBody(ctx, "https://mangafire.to/ajax/read/"+kind+"/"+ch.ID+"?vrf="+url.QueryEscape(vrf), referer)
+	if err != nil {
+		return nil, fmt.Errorf("pages of %s %s: %w", kind, ch.ID, err)
+	}
+	return c.parser.Pages(body)
+}
+
+var (
+	chapterCountRe = regexp.MustCompile(`\((\d+) Chapters?\)`)
+	// volumeRe finds the volume in titles such as "Vol.3 Chapter 20".
+	volumeRe = regexp.MustCompile(`(?i)\bvol(?:ume)?\.?\s*(\d+(?:\.\d+)?)`)
+)
+
+// MangaLanguages parses the chapter language dropdown of a detail page.
+func (p *Parser) MangaLanguages(doc *goquery.Document) ([]MangaLanguage, error) {
+	d := newDiag("detail")
+	var out []MangaLanguage
+	p.find(d, doc.Selection, "languages").Each(func(_ int, s *goquery.Selection) {
+		code := ParseLanguage(s.AttrOr("data-code", ""))
+		if code == "" {
+			return
+		}
+		text := cleanText(s.Text())
+		ml := MangaLanguage{Language: code, Name: cleanText(s.AttrOr("data-title", ""))}
+		if m := chapterCountRe.FindStringSubmatch(text); m != nil {
+			ml.Chapters, _ = strconv.Atoi(m[1])
+			text = strings.TrimSpace(strings.Replace(text, m[0], "", 1))
+		}
+		if ml.Name == "" {
+			ml.Name = text
+		}
+		out = append(out, ml)
+	})
+	d.require("languages")
+	return out, d.err()
+}
+
+// Chapters parses a manga's chapter list in lang from the two ajax
+// responses fetched by Client.Chapters: list from /ajax/manga (dates) and
+// read from /ajax/read (IDs). Chapters are matched on their number. list
+// may be nil, leaving the dates empty; volume lists come without one.
+func (p *Parser) Chapters(manga MangaRef, lang Language, list, read []byte) ([]Chapter, error) {
+	var listHTML string
+	if list != nil {
+		if err := decodeAjax(list, &listHTML); err != nil {
+			return nil, err
+		}
+	}
+	var readResult struct {
+		HTML string `json:"html"`
+	}
+	if err := decodeAjax(read, &readResult); err != nil {
+		return nil, err
+	}
+	d := newDiag("chapters")
+
+	listDoc, err := goquery.NewDocumentFromReader(strings.NewReader(listHTML))
+	if err != nil {
+		return nil, err
+	}
+	// the lists are in the same order, so the nth upload of a number in
+	// one is the nth in the other
+	dates := make(map[float64][]string)
+	p.find(d, listDoc.Selection, "chapter-list").Each(func(_ int, s *goquery.Selection) {
+		a := p.find(d, s, "chapter-list.link").First()
+		n, ok := ParseChapterNumber(s.AttrOr("data-number", ""))
+		if !ok {
+			ref, err := ParseReaderURL(a.AttrOr("href", ""))
+			if err != nil {
+				return
+			}
+			n = normalizeNumber(ref.Number)
+		}
+		dates[n] = append(dates[n], p.find(d, a, "chapter-list.date").Last().Text())
+	})
+
+	readDoc, err := goquery.NewDocumentFromReader(strings.NewReader(readResult.HTML))
+	if err != nil {
+		return nil, err
+	}
+	out := []Chapter{}
+	p.find(d, readDoc.Selection, "read-list").Each(func(_ int, a *goquery.Selection) {
+		href := a.AttrOr("href", "")
+		ref, rerr := ParseReaderURL(href)
+		n, ok := ParseChapterNumber(a.AttrOr("data-number", ""))
+		switch {
+		case ok:
+		case rerr == nil:
+			n = normalizeNumber(ref.Number)
+		default:
+			if n, ok = ParseChapterNumber(a.AttrOr("title", a.Text())); !ok {
+				return
+			}
+		}
+		kind := "chapter"
+		if rerr == nil {
+			kind = ref.Kind
+		}
+		ch := Chapter{
+			ID:       a.AttrOr("data-id", ""),
+			Manga:    manga,
+			Kind:     kind,
+			Number:   n,
+			Title:    cleanText(a.AttrOr("title", a.Text())),
+			Language: lang,
+			Url:      absURL(href),
+		}
+		if ch.Url == "" {
+			ch.Url = ReaderURL(manga, lang, kind, n)
+		}
+		if kind == "volume" {
+			ch.Volume = n
+		} else if m := volumeRe.FindStringSubmatch(ch.Title); m != nil {
+			ch.Volume, _ = strconv.ParseFloat(m[1], 64)
+		}
+		if list := dates[n]; len(list) > 0 {
+			ch.Date = parseSiteDate(list[0])
+			dates[n] = list[1:]
+		}
+		out = append(out, ch)
+	})
+	if len(out) == 0 && strings.TrimSpace(readDoc.Text()) != "" {
+		d.require("read-list")
+	}
+	return out, d.err()
+}
+
+// Pages parses the reader response of a chapter. Each image is sent as
+// [url, kind, offset].
+func (p *Parser) Pages(body []byte) ([]Page, error) {
+	var result struct {
+		Images [][]interface{} `json:"images"`
+	}
+	if err := decodeAjax(body, &result); err != nil {
+		return nil, err
+	}
+	pages := make([]Page, 0, len(result.Images))
+	for i, img := range result.Images {
+		if len(img) == 0 {
+			return nil, fmt.Errorf("page %d: empty image entry", i+1)
+		}
+		u, ok := img[0].(string)
+		if !ok || u == "" {
+			return nil, fmt.Errorf("page %d: no image URL", i+1)
+		}
+		pg := Page{Url: u}
+		if len(img) > 2 {
+			if off, ok := img[2].(float64); ok {
+				pg.Offset = int(off)
+			}
+		}
+		pages = append(pages, pg)
+	}
+	return pages, nil
+}
@@ -0,0 +1,253 @@
+package mfire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseLanguage(t *testing.T) {
+	for in, want := range map[string]Language{
+		"EN": English, " es-la ": SpanishLatAm, "PT_BR": PortugueseBrazil, "": "",
+	} {
+		if got := ParseLanguage(in); got != want {
+			t.Errorf("ParseLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := ParseLanguages("es, ,FR,en"); !reflect.DeepEqual(got, []Language{Spanish, French, English}) {
+		t.Errorf("ParseLanguages = %v", got)
+	}
+}
+
+func TestRankLanguages(t *testing.T) {
+	available := []Language{English, SpanishLatAm, French, Japanese, PortugueseBrazil}
+	tests := []struct {
+		preferred []Language
+		want      []Language
+	}{
+		{[]Language{English}, []Language{English}},
+		{[]Language{Spanish, English}, []Language{SpanishLatAm, English}},
+		{[]Language{Portuguese, French}, []Language{PortugueseBrazil, French}},
+		{[]Language{"de"}, nil},
+	}
+	for _, tt := range tests {
+		if got := rankLanguages(available, tt.preferred); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rankLanguages(%v) = %v, want %v", tt.preferred, got, tt.want)
+		}
+	}
+}
+
+func TestParserMangaLanguages(t *testing.T) {
+	langs, err := NewParser(nil).MangaLanguages(loadFixture(t, "detail.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	english := false
+	for _, l := range langs {
+		if l.Language == "" || l.Name == "" || l.Chapters <= 0 {
+			t.Errorf("bad language %+v", l)
+		}
+		english = english || l.Language == English
+	}
+	if !english {
+		t.Errorf("languages = %+v, want English among them", langs)
+	}
+}
+
+// editReadList rewrites the chapter links of a corpus reader list.
+func editReadList(t *testing.T, body string, edit func(links *goquery.Selection)) string {
+	t.Helper()
+	var list struct {
+		Result struct {
+			HTML string `json:"html"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(list.Result.HTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(doc.Find("a[data-id]"))
+	html, err := doc.Find("body").Html()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Result.HTML = html
+	out, err := json.Marshal(map[string]interface{}{"status": 200, "result": list.Result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestParserChapters(t *testing.T) {
+	manga := MangaRef{ID: "dkw", Slug: "one-piecee"}
+	list, read := readFixture(t, "chapters_en.json"), readFixture(t, "read_chapters_en.json")
+	chapters, err := NewParser(nil).Chapters(manga, English, []byte(list), []byte(read))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) == 0 {
+		t.Fatal("no chapters")
+	}
+	for i, ch := range chapters {
+		checkChapter(t, "chapters_en.json", ch)
+		if ch.Manga != manga || ch.Kind != "chapter" || ch.Language != English {
+			t.Errorf("chapters[%d] = %+v", i, ch)
+		}
+		if i > 0 && ch.Number > chapters[i-1].Number {
+			t.Errorf("chapters[%d] = %v after %v, want newest first", i, ch.Number, chapters[i-1].Number)
+		}
+	}
+
+	// a volume in the title is parsed out of it
+	read = editReadList(t, read, func(links *goquery.Selection) {
+		last := links.Last()
+		last.SetAttr("title", "Vol.3 "+last.AttrOr("title", ""))
+		last.SetText("Vol.3 " + last.Text())
+	})
+	chapters, err = NewParser(nil).Chapters(manga, English, []byte(list), []byte(read))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(chapters); n < 2 || chapters[n-1].Volume != 3 || chapters[0].Volume != 0 {
+		t.Errorf("volumes = %v, %v; want 0, 3", chapters[0].Volume, chapters[n-1].Volume)
+	}
+}
+
+func TestParserPages(t *testing.T) {
+	pages, err := NewParser(nil).Pages([]byte(readFixture(t, "reader_chapter.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no pages")
+	}
+	for i, p := range pages {
+		if !strings.HasPrefix(p.Url, "https://") || p.Offset < 0 {
+			t.Errorf("pages[%d] = %+v", i, p)
+		}
+	}
+
+	pages, err = NewParser(nil).Pages([]byte(`{"status":200,"result":{"images":[` +
+		`["https://static.mfcdn.nl/1/p/1/01.jpg",1,0],["https://static.mfcdn.nl/1/p/1/02.jpg",1,5]]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].Scrambled() || !pages[1].Scrambled() || pages[1].Offset != 5 ||
+		pages[0].Url != "https://static.mfcdn.nl/1/p/1/01.jpg" {
+		t.Errorf("pages = %+v", pages)
+	}
+}
+
+// TestClientChapterList replays the corpus English chapters and Latin
+// American Spanish ones lacking the newest, and checks a Spanish reader gets
+// es-la chapters with English filling the gap.
+func TestClientChapterList(t *testing.T) {
+	list, read := readFixture(t, "chapters_en.json"), readFixture(t, "read_chapters_en.json")
+	esList := strings.ReplaceAll(list, "/en/", "/es-la/")
+	esRead := editReadList(t, strings.ReplaceAll(read, "/en/", "/es-la/"), func(links *goquery.Selection) {
+		links.First().Remove()
+	})
+
+	html := http.Header{"Content-Type": {"text/html"}}
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	interaction := func(u string, h http.Header, body string) Interaction {
+		return Interaction{
+			Request:  RecordedRequest{Method: "GET", URL: u},
+			Response: RecordedResponse{Status: 200, Header: h, Body: body},
+		}
+	}
+	cassette := &Cassette{Interactions: []Interaction{
+		interaction("https://mangafire.to/manga/one-piecee.dkw", html, readFixture(t, "detail.html")),
+		interaction("https://mangafire.to/ajax/manga/dkw/chapter/en", jsonHeader, list),
+		interaction("https://mangafire.to/ajax/read/dkw/chapter/en?vrf=VRF", jsonHeader, read),
+		interaction("https://mangafire.to/ajax/manga/dkw/chapter/es-la", jsonHeader, esList),
+		interaction("https://mangafire.to/ajax/read/dkw/chapter/es-la?vrf=VRF", jsonHeader, esRead),
+	}}
+	manga := MangaRef{ID: "dkw", Slug: "one-piecee"}
+
+	c := NewClient(WithTransport(NewReplayTransport(cassette)), WithLanguages(Spanish, English))
+	chapters, err := c.ChapterList(context.Background(), manga)
+	if err != nil {
+		t.Fatal(err)
+	}
+	english, err := NewParser(nil).Chapters(manga, English, []byte(list), []byte(read))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want []string
+	for i, ch := range english {
+		lang := "es-la"
+		if i == 0 {
+			lang = "en"
+		}
+		want = append(want, FormatNumber(ch.Number)+"/"+lang)
+	}
+	for _, ch := range chapters {
+		got = append(got, FormatNumber(ch.Number)+"/"+string(ch.Language))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// ChapterUploads offers both uploads of each chapter but the newest,
+	// and marks the one ChapterList kept
+	c = NewClient(WithTransport(NewReplayTransport(cassette)), WithLanguages(Spanish, English))
+	groups, err := c.ChapterUploads(context.Background(), manga)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != len(chapters) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(chapters))
+	}
+	for i, g := range groups {
+		wantN := 2
+		if i == 0 {
+			wantN = 1
+		}
+		if len(g.Chapters) != wantN {
+			t.Errorf("group %s has %d uploads, want %d", FormatNumber(g.Number), len(g.Chapters), wantN)
+		}
+		if g.Best != chapters[i] {
+			t.Errorf("group %s: best = %+v, want %+v", FormatNumber(g.Number), g.Best, chapters[i])
+		}
+	}
+
+	// ReadChapter matches numbers that arithmetic left a hair off
+	cassette.Interactions = append(cassette.Interactions,
+		interaction("https://mangafire.to/ajax/read/chapter/3199050?vrf=VRF", jsonHeader, readFixture(t, "reader_chapter.json")))
+	c = NewClient(WithTransport(NewReplayTransport(cassette)), WithLanguages(English))
+	n := 1097.0
+	for i := 0; i < 5; i++ {
+		n += 0.1
+	}
+	ch, pages, err := c.ReadChapter(context.Background(), manga, n)
+	if err != nil || ch.Number != 1097.5 || len(pages) == 0 {
+		t.Errorf("ReadChapter(%v) = %s, %d pages, %v; want chapter 1097.5", n, FormatNumber(ch.Number), len(pages), err)
+	}
+
+	c = NewClient(WithTransport(NewReplayTransport(cassette)), WithLanguages("de"))
+	if _, err := c.ChapterList(context.Background(), manga); !errors.Is(err, ErrNoLanguage) {
+		t.Errorf("err = %v, want ErrNoLanguage", err)
+	}
+}
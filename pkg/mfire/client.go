@@ -2,15 +2,17 @@ package mfire
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
@@ -18,38 +20,111 @@ import (
 // Client handles HTTP requests to MangaFire and parsing.
 type Client struct {
 	http *http.Client
+
+	proxy    *url.URL
+	proxies  *ProxyPool
+	jar      http.CookieJar
+	base     http.RoundTripper
+	recorder *RecordingTransport
+
+	cache    CacheStore
+	cacheTTL time.Duration
+	limiter  *rateLimiter
+	hosts    *hostLimiter
+
+	session  sessionState
+	parser   *Parser
+	warnings func(error) // see WithWarnings
+
+	taxonomyMu sync.Mutex
+	taxonomy   *Taxonomy
+
+	languages   []Language   // preferred chapter languages, most preferred first
+	dedupeRules []DedupeRule // how ChapterList picks among duplicate uploads
+
+	profileMu   sync.Mutex
+	profiles    []HeaderProfile
+	profileIdx  int
+	syncProfile bool
+	synced      bool
 }
 
 // NewClient returns a client with a reasonable timeout and TLS settings that
-// tolerate typical scraping setups.
-func NewClient() *Client {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// tolerate typical scraping setups. Options customise proxies and other
+// transport behaviour; without any the environment proxy settings are used.
+func NewClient(opts ...Option) *Client {
+	c := &Client{parser: NewParser(nil)}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// the default transport sends headers in the profile's order
+	var rt http.RoundTripper = newOrderedTransport(c.proxyFunc())
+	if c.base != nil {
+		rt = c.base
+	}
+	if c.recorder != nil {
+		c.recorder.Base = rt
+		rt = c.recorder
+	}
+	if c.proxies != nil {
+		rt = &proxyTransport{pool: c.proxies, base: rt}
+	}
+	if c.limiter != nil || c.hosts != nil {
+		rt = &limitTransport{limiter: c.limiter, hosts: c.hosts, base: rt}
+	}
+	if c.cache != nil {
+		// outermost, so cache hits don't consume a proxy
+		rt = &CacheTransport{Base: rt, Store: c.cache, MinTTL: c.cacheTTL}
 	}
 	// include a cookie jar to preserve session cookies between requests;
 	// some sites set a session cookie on the home page which later requests
-	// expect.
-	jar, _ := cookiejar.New(nil)
-	return &Client{
-		http: &http.Client{Transport: tr, Timeout: 15 * time.Second, Jar: jar},
+	// expect. WithCookieJar can swap in a persistent one.
+	if c.jar == nil {
+		c.jar, _ = cookiejar.New(nil)
 	}
+	c.http = &http.Client{Transport: rt, Timeout: 15 * time.Second, Jar: c.jar}
+	return c
+}
+
+// StatusError is returned when the site answers with an HTTP error status.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "bad status: " + e.Status
 }
 
+// vrfFromBrowser is fetchVrfWithBrowser, swapped out by tests that have no
+// browser.
+var vrfFromBrowser = fetchVrfWithBrowser
+
 // fetchVrfWithBrowser launches a headless Chrome instance, loads the site,
 // injects the search query into the page and listens for the outgoing AJAX
 // request that contains a server-generated `vrf` token. Returns the token or
-// an error if not found within timeout.
-func fetchVrfWithBrowser(q string, timeout time.Duration) (string, error) {
+// an error if not found within timeout, along with what the browser reported
+// about itself so the HTTP header profile can be synced with it.
+func fetchVrfWithBrowser(q string, opts browserOptions, timeout time.Duration) (string, browserInfo, error) {
+	var info browserInfo
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	// Exec allocator with common flags. Requires Chrome/Chromium on the host.
-	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx,
+	allocOpts := []chromedp.ExecAllocatorOption{
 		chromedp.Flag("headless", true),
 		chromedp.Flag("disable-gpu", true),
 		chromedp.Flag("no-first-run", true),
 		chromedp.Flag("no-default-browser-check", true),
-	)
+	}
+	if opts.proxyServer != "" {
+		allocOpts = append(allocOpts, chromedp.ProxyServer(opts.proxyServer))
+	}
+	if opts.profile != nil {
+		allocOpts = append(allocOpts, chromedp.UserAgent(opts.profile.UserAgent))
+	}
+	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, allocOpts...)
 	defer allocCancel()
 
 	// Create a chromedp context and silence chromedp's internal debug logs
@@ -81,7 +156,15 @@ func fetchVrfWithBrowser(q string, timeout time.Duration) (string, error) {
 
 	// Enable network domain so we receive network events
 	if err := chromedp.Run(cctx, network.Enable()); err != nil {
-		return "", err
+		return "", info, err
+	}
+	// The user agent flag alone leaves Chrome reporting its own version
+	// and platform in the client hints; override them to match.
+	if p := opts.profile; p != nil {
+		override := emulation.SetUserAgentOverride(p.UserAgent).WithUserAgentMetadata(p.userAgentMetadata())
+		if err := chromedp.Run(cctx, override); err != nil {
+			return "", info, err
+		}
 	}
 
 	// Load the page and trigger the site's search UI via injected JS.
@@ -96,30 +179,49 @@ func fetchVrfWithBrowser(q string, timeout time.Duration) (string, error) {
 	if err := chromedp.Run(cctx,
 		chromedp.Navigate("https://mangafire.to/home"),
 		chromedp.WaitVisible("body", chromedp.ByQuery),
+		chromedp.Evaluate(browserInfoJS, &info),
 		chromedp.Evaluate(js, nil),
 	); err != nil {
-		return "", err
+		return "", info, err
 	}
 
 	select {
 	case <-done:
-		return vrf, nil
+		return vrf, info, nil
 	case <-ctx.Done():
-		return "", fmt.Errorf("timeout waiting for vrf: %w", ctx.Err())
+		return "", info, fmt.Errorf("timeout waiting for vrf: %w", ctx.Err())
 	}
 }
 
-func (c *Client) fetchDocument(rawurl string) (*goquery.Document, error) {
-	req, err := http.NewRequest("GET", rawurl, nil)
+// browserOptions configures the headless browser launched by
+// fetchVrfWithBrowser.
+type browserOptions struct {
+	proxyServer string         // empty for a direct connection
+	profile     *HeaderProfile // nil to keep the browser's own fingerprint
+}
+
+// browserVrf obtains a server-generated vrf token for q from a headless
+// browser launched with the Client's proxy and header profile. The returned
+// context pins the HTTP client to the browser's proxy, so a request retried
+// with the token exits from the same IP.
+func (c *Client) browserVrf(ctx context.Context, q string) (string, context.Context, error) {
+	proxyServer, pctx, err := c.browserProxy(ctx)
+	if err != nil {
+		return "", ctx, err
+	}
+	bopts := browserOptions{proxyServer: proxyServer, profile: c.browserProfile()}
+	vrf, info, err := vrfFromBrowser(q, bopts, 20*time.Second)
+	c.syncFromBrowser(info)
+	return vrf, pctx, err
+}
+
+func (c *Client) fetchDocument(ctx context.Context, rawurl string) (*goquery.Document, error) {
+	// Headers come from the Client's header profile (a common browser by
+	// default) to reduce the chance of blocking.
+	req, err := c.newRequest(ctx, rawurl, "https://mangafire.to/")
 	if err != nil {
 		return nil, err
 	}
-	// Use a common browser User-Agent to reduce the chance of blocking.
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36")
-	req.Header.Set("Referer", "https://mangafire.to/")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
 
 	resp, err := c.http.Do(req)
 	if err != nil {
@@ -128,45 +230,55 @@ func (c *Client) fetchDocument(rawurl string) (*goquery.Document, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("bad status: %s", resp.Status)
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 	return goquery.NewDocumentFromReader(resp.Body)
 }
 
+// fetchBody returns the raw body of rawurl. Requests to the site's ajax
+// endpoints are marked as XHR the way the site's own scripts send them.
+func (c *Client) fetchBody(ctx context.Context, rawurl, referer string) ([]byte, error) {
+	req, err := c.newRequest(ctx, rawurl, referer)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(req.URL.Path, "/ajax/") {
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // FetchHome lists manga titles found on the home page, limited to 'limit'.
 func (c *Client) FetchHome(limit int) ([]Manga, error) {
-	doc, err := c.fetchDocument("https://mangafire.to/home")
+	doc, err := c.fetchDocument(context.Background(), "https://mangafire.to/home")
 	if err != nil {
 		return nil, err
 	}
-	mangas := make([]Manga, 0, limit)
-	doc.Find(".original.card-lg .unit .inner").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if len(mangas) >= limit {
-			return false
-		}
-		a := s.Find(".info > a").First()
-		title := a.Text()
-		href, _ := a.Attr("href")
-		cover, _ := s.Find("img").Attr("src")
-		// Normalize url if relative
-		u := href
-		if parsed, err := url.Parse(href); err == nil && !parsed.IsAbs() {
-			u = "https://mangafire.to" + href
-		}
-		mangas = append(mangas, Manga{Title: title, Url: u, Cover: cover})
-		return true
-	})
-	return mangas, nil
+	return c.parser.Cards(doc, "home", limit)
 }
 
 // Search performs a site search using the required vrf parameter and returns up to limit results.
 func (c *Client) Search(query string, limit int) ([]Manga, error) {
 	qTrim := strings.TrimSpace(query)
+	ctx := context.Background()
 
-	// Preflight: fetch the filter page to populate cookies and any session state.
-	// Many clients (Kotatsu/Mihon) request /filter before performing searches
-	// which sets cookies the server expects for subsequent calls.
-	_, _ = c.fetchDocument("https://mangafire.to/filter")
+	// Preflight once per session rather than on every search; see
+	// ensureSession. The preflight is best-effort: when /filter is blocked
+	// the search and its headless-browser fallback still get their chance.
+	// The preflight error is part of the search's error if they fail too,
+	// and a warning (see WithWarnings) if they don't.
+	fresh, preflightErr := c.ensureSession(ctx)
 
 	// Build keyword query similar to the reference implementation: split on
 	// whitespace, URL-encode each part, then join with '+' so phrases like
@@ -184,94 +296,56 @@ func (c *Client) Search(query string, limit int) ([]Manga, error) {
 
 	searchURL := "https://mangafire.to/filter?keyword=" + encodedQuery + "&vrf=" + url.QueryEscape(vrf)
 
-	// Build request manually so we can set Referer to the filter page (the
-	// Kotlin implementation uses a Referer header pointing at the domain or
-	// filter page via an interceptor). Some servers expect the Referer to be
-	// the search/filter UI.
-	req, err := http.NewRequest("GET", searchURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36")
-	req.Header.Set("Referer", "https://mangafire.to/filter")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-
-	resp, err := c.http.Do(req)
+	// The request's Referer points at the filter page (the Kotlin
+	// implementation uses a Referer header pointing at the domain or filter
+	// page via an interceptor). Some servers expect the Referer to be the
+	// search/filter UI.
+	resp, refreshErr, err := c.doSearchRequest(ctx, searchURL, fresh)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if refreshErr != nil {
+		preflightErr = refreshErr
+	}
 
-	if resp.StatusCode >= 400 {
-		// If we hit a 403, try a headless-browser fallback to obtain a
-		// server-generated vrf token (the site computes vrf client-side via JS).
-		if resp.StatusCode == 403 {
-			fmt.Printf("search: initial request returned 403 — attempting headless-browser vrf fallback\n")
-			browserVrf, berr := fetchVrfWithBrowser(qTrim, 20*time.Second)
-			if berr == nil && browserVrf != "" {
-				// retry the search using the browser-provided vrf
-				searchURL = "https://mangafire.to/filter?keyword=" + encodedQuery + "&vrf=" + url.QueryEscape(browserVrf)
-				req2, rerr := http.NewRequest("GET", searchURL, nil)
-				if rerr != nil {
-					return nil, rerr
-				}
-				req2.Header = req.Header.Clone()
-				resp2, rerr := c.http.Do(req2)
-				if rerr != nil {
-					return nil, rerr
-				}
-				defer resp2.Body.Close()
-				if resp2.StatusCode >= 400 {
-					return nil, fmt.Errorf("bad status: %s", resp2.Status)
-				}
-				doc, err := goquery.NewDocumentFromReader(resp2.Body)
-				if err != nil {
-					return nil, err
-				}
-				// continue parsing below using doc
-				mangas := make([]Manga, 0, limit)
-				doc.Find(".original.card-lg .unit .inner").EachWithBreak(func(i int, s *goquery.Selection) bool {
-					if len(mangas) >= limit {
-						return false
-					}
-					a := s.Find(".info > a").First()
-					title := a.Text()
-					href, _ := a.Attr("href")
-					cover, _ := s.Find("img").Attr("src")
-					u := href
-					if parsed, err := url.Parse(href); err == nil && !parsed.IsAbs() {
-						u = "https://mangafire.to" + href
-					}
-					mangas = append(mangas, Manga{Title: title, Url: u, Cover: cover})
-					return true
-				})
-				return mangas, nil
+	// If we hit a 403, try a headless-browser fallback to obtain a
+	// server-generated vrf token (the site computes vrf client-side via JS).
+	if resp.StatusCode == 403 {
+		fmt.Printf("search: initial request returned 403 — attempting headless-browser vrf fallback\n")
+		browserVrf, pctx, berr := c.browserVrf(ctx, qTrim)
+		if berr == nil && browserVrf != "" {
+			// retry the search using the browser-provided vrf and the
+			// (possibly freshly synced) header profile; the blocked
+			// response is closed first so it doesn't hold a host slot
+			resp.Body.Close()
+			searchURL = "https://mangafire.to/filter?keyword=" + encodedQuery + "&vrf=" + url.QueryEscape(browserVrf)
+			req2, rerr := c.newRequest(pctx, searchURL, "https://mangafire.to/filter")
+			if rerr != nil {
+				return nil, rerr
+			}
+			resp2, rerr := c.http.Do(req2)
+			if rerr != nil {
+				return nil, rerr
 			}
+			defer resp2.Body.Close()
+			resp = resp2
 		}
-		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+	if resp.StatusCode >= 400 {
+		err := &StatusError{Code: resp.StatusCode, Status: resp.Status}
+		if preflightErr != nil {
+			return nil, fmt.Errorf("%w (after %v)", err, preflightErr)
+		}
+		return nil, err
+	}
+	if preflightErr != nil {
+		c.warn(preflightErr)
 	}
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	mangas := make([]Manga, 0, limit)
-	doc.Find(".original.card-lg .unit .inner").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if len(mangas) >= limit {
-			return false
-		}
-		a := s.Find(".info > a").First()
-		title := a.Text()
-		href, _ := a.Attr("href")
-		cover, _ := s.Find("img").Attr("src")
-		u := href
-		if parsed, err := url.Parse(href); err == nil && !parsed.IsAbs() {
-			u = "https://mangafire.to" + href
-		}
-		mangas = append(mangas, Manga{Title: title, Url: u, Cover: cover})
-		return true
-	})
-	return mangas, nil
+	return c.parser.Cards(doc, "filter", limit)
 }
@@ -0,0 +1,454 @@
+package mfire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieFormat selects the on-disk format of a FileJar.
+type CookieFormat int
+
+const (
+	// CookieNetscape is the tab-separated cookies.txt format used by curl,
+	// wget, yt-dlp and most "export cookies.txt" browser extensions.
+	CookieNetscape CookieFormat = iota
+	// CookieJSON is a JSON array compatible with the export format of
+	// browser extensions such as EditThisCookie and Cookie-Editor.
+	CookieJSON
+)
+
+// FileJar is an http.CookieJar that persists its cookies to a file, so
+// session and clearance cookies survive restarts. Matching is delegated to
+// net/http/cookiejar; FileJar keeps a copy of every stored cookie so it can
+// write them back out. It is safe for concurrent use.
+type FileJar struct {
+	path   string
+	format CookieFormat
+
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	entries map[string]storedCookie
+	saveErr error
+}
+
+// storedCookie is the persisted form of a cookie. The JSON field names follow
+// the common browser-extension export format.
+type storedCookie struct {
+	Domain         string  `json:"domain"`
+	HostOnly       bool    `json:"hostOnly"`
+	Path           string  `json:"path"`
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Secure         bool    `json:"secure"`
+	HttpOnly       bool    `json:"httpOnly"`
+	Session        bool    `json:"session"`
+	ExpirationDate float64 `json:"expirationDate,omitempty"`
+}
+
+func (s storedCookie) key() string {
+	return s.Domain + ";" + s.Path + ";" + s.Name
+}
+
+func (s storedCookie) expires() time.Time {
+	if s.Session || s.ExpirationDate <= 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(s.ExpirationDate)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func (s storedCookie) expired(now time.Time) bool {
+	exp := s.expires()
+	return !exp.IsZero() && !exp.After(now)
+}
+
+// NewFileJar returns a jar backed by the file at path, loading any cookies
+// already stored there. The format is JSON when path ends in ".json" and
+// Netscape cookies.txt otherwise. A missing file is not an error.
+func NewFileJar(path string) (*FileJar, error) {
+	format := CookieNetscape
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = CookieJSON
+	}
+	jar, _ := cookiejar.New(nil)
+	j := &FileJar{path: path, format: format, jar: jar, entries: make(map[string]storedCookie)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := j.load(f, nil); err != nil {
+		return nil, fmt.Errorf("load cookies from %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// SetCookies implements http.CookieJar and writes the jar back to disk when
+// that changed it. Cookies the underlying jar rejects, such as ones for
+// another domain, are not persisted. Write errors are reported by the next
+// call to Save.
+func (j *FileJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+	now := time.Now()
+	changed := false
+	for _, c := range cookies {
+		s := toStored(u, c)
+		old, ok := j.entries[s.key()]
+		if c.MaxAge < 0 || s.expired(now) {
+			if ok {
+				delete(j.entries, s.key())
+				changed = true
+			}
+			continue
+		}
+		if (!ok || old != s) && j.holds(s) {
+			j.entries[s.key()] = s
+			changed = true
+		}
+	}
+	if changed {
+		j.saveErr = j.saveLocked()
+	}
+}
+
+// holds reports whether the underlying jar kept s.
+func (j *FileJar) holds(s storedCookie) bool {
+	for _, c := range j.jar.Cookies(s.url()) {
+		if c.Name == s.Name && c.Value == s.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// Cookies implements http.CookieJar.
+func (j *FileJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// Import merges cookies exported from a browser (Netscape cookies.txt or
+// JSON, detected from the content) into the jar and saves it. Only cookies
+// for mangafire.to and its subdomains that the jar accepts are kept, so a
+// whole-browser export is fine. It returns the number of cookies imported.
+func (j *FileJar) Import(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n, err := j.load(f, siteCookie)
+	if err != nil {
+		return n, fmt.Errorf("import cookies from %s: %w", path, err)
+	}
+	return n, j.saveLocked()
+}
+
+// Save writes the jar to its file. It also reports any error from an
+// earlier automatic save.
+func (j *FileJar) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.saveLocked(); err != nil {
+		return err
+	}
+	err := j.saveErr
+	j.saveErr = nil
+	return err
+}
+
+// Len returns the number of unexpired cookies in the jar.
+func (j *FileJar) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, s := range j.entries {
+		if !s.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// load reads cookies in either format and adds the unexpired ones that keep
+// allows, or all when keep is nil, and that the underlying jar accepts.
+func (j *FileJar) load(r io.Reader, keep func(storedCookie) bool) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	var list []storedCookie
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		list, err = parseJSONCookies(trimmed)
+	} else {
+		list, err = parseNetscapeCookies(data)
+	}
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	n := 0
+	for _, s := range list {
+		if s.Name == "" || s.Domain == "" || s.expired(now) {
+			continue
+		}
+		if s.Path == "" {
+			s.Path = "/"
+		}
+		if keep != nil && !keep(s) {
+			continue
+		}
+		j.jar.SetCookies(s.url(), []*http.Cookie{s.cookie()})
+		if !j.holds(s) {
+			continue
+		}
+		j.entries[s.key()] = s
+		n++
+	}
+	return n, nil
+}
+
+// siteCookie reports whether s is for the site or one of its subdomains.
+func siteCookie(s storedCookie) bool {
+	d, site := strings.TrimPrefix(s.Domain, "."), siteURL.Hostname()
+	return d == site || strings.HasSuffix(d, "."+site)
+}
+
+// saveLocked writes the jar atomically: a temporary file in the same
+// directory is renamed over the target so a crash never truncates it.
+func (j *FileJar) saveLocked() error {
+	now := time.Now()
+	list := make([]storedCookie, 0, len(j.entries))
+	for _, s := range j.entries {
+		if !s.expired(now) {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].key() < list[b].key() })
+
+	var buf bytes.Buffer
+	if j.format == CookieJSON {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(list); err != nil {
+			return err
+		}
+	} else {
+		writeNetscapeCookies(&buf, list)
+	}
+	return writeFileAtomic(j.path, buf.Bytes(), 0o600)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeAtomic(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeAtomic writes path through a temporary file in the same directory,
+// renamed into place only once write has succeeded, so readers never see
+// a partial file.
+func writeAtomic(path string, perm os.FileMode, write func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func toStored(u *url.URL, c *http.Cookie) storedCookie {
+	s := storedCookie{
+		Domain:   strings.ToLower(c.Domain),
+		Path:     c.Path,
+		Name:     c.Name,
+		Value:    c.Value,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if s.Domain == "" {
+		s.Domain = strings.ToLower(u.Hostname())
+		s.HostOnly = true
+	} else if !strings.HasPrefix(s.Domain, ".") {
+		s.Domain = "." + s.Domain
+	}
+	if s.Path == "" || !strings.HasPrefix(s.Path, "/") {
+		// default-path per RFC 6265 section 5.1.4
+		s.Path = "/"
+		if i := strings.LastIndex(u.Path, "/"); i > 0 {
+			s.Path = u.Path[:i]
+		}
+	}
+	switch {
+	case c.MaxAge > 0:
+		s.ExpirationDate = float64(time.Now().Add(time.Duration(c.MaxAge) * time.Second).Unix())
+	case !c.Expires.IsZero():
+		s.ExpirationDate = float64(c.Expires.Unix())
+	default:
+		s.Session = true
+	}
+	return s
+}
+
+// url returns a URL the cookie can be set from.
+func (s storedCookie) url() *url.URL {
+	scheme := "http"
+	if s.Secure {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: strings.TrimPrefix(s.Domain, "."), Path: s.Path}
+}
+
+func (s storedCookie) cookie() *http.Cookie {
+	c := &http.Cookie{
+		Name:     s.Name,
+		Value:    s.Value,
+		Path:     s.Path,
+		Secure:   s.Secure,
+		HttpOnly: s.HttpOnly,
+		Expires:  s.expires(),
+	}
+	if !s.HostOnly {
+		c.Domain = strings.TrimPrefix(s.Domain, ".")
+	}
+	return c
+}
+
+func parseJSONCookies(data []byte) ([]storedCookie, error) {
+	var list []storedCookie
+	if data[0] == '{' {
+		// some exporters wrap the list: {"cookies": [...]}
+		var wrapped struct {
+			Cookies []storedCookie `json:"cookies"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, err
+		}
+		list = wrapped.Cookies
+	} else if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	// exporters disagree on the leading dot; store domain cookies with it
+	// and host-only ones without, like the Netscape format
+	for i := range list {
+		s := &list[i]
+		s.Domain = strings.TrimPrefix(strings.ToLower(s.Domain), ".")
+		if !s.HostOnly && s.Domain != "" {
+			s.Domain = "." + s.Domain
+		}
+	}
+	return list, nil
+}
+
+const httpOnlyPrefix = "#HttpOnly_"
+
+func parseNetscapeCookies(data []byte) ([]storedCookie, error) {
+	var list []storedCookie
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimRight(sc.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(text, httpOnlyPrefix) {
+			text = strings.TrimPrefix(text, httpOnlyPrefix)
+			httpOnly = true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		f := strings.Split(text, "\t")
+		if len(f) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 tab-separated fields, got %d", line, len(f))
+		}
+		exp, err := strconv.ParseFloat(f[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad expiry %q", line, f[4])
+		}
+		s := storedCookie{
+			Domain:         strings.ToLower(f[0]),
+			HostOnly:       !strings.EqualFold(f[1], "TRUE"),
+			Path:           f[2],
+			Secure:         strings.EqualFold(f[3], "TRUE"),
+			ExpirationDate: exp,
+			Name:           f[5],
+			Value:          f[6],
+			HttpOnly:       httpOnly,
+			Session:        exp <= 0,
+		}
+		if !s.HostOnly && !strings.HasPrefix(s.Domain, ".") {
+			s.Domain = "." + s.Domain
+		}
+		list = append(list, s)
+	}
+	return list, sc.Err()
+}
+
+func writeNetscapeCookies(w io.Writer, list []storedCookie) {
+	fmt.Fprintln(w, "# Netscape HTTP Cookie File")
+	fmt.Fprintln(w, "# Written by go-mfire. Edit at your own risk.")
+	fmt.Fprintln(w)
+	bool2 := func(b bool) string {
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	for _, s := range list {
+		domain := s.Domain
+		if s.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		exp := int64(0)
+		if !s.Session {
+			exp = int64(s.ExpirationDate)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, bool2(!s.HostOnly), s.Path, bool2(s.Secure), exp, s.Name, s.Value)
+	}
+}
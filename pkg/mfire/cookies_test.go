@@ -0,0 +1,167 @@
+package mfire
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieImport(t *testing.T) {
+	future := time.Now().Add(24 * time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+	tests := []struct {
+		name string
+		data string
+		want string // name=value of each cookie sent to https://mangafire.to/filter
+		n    int
+	}{
+		{
+			name: "netscape",
+			data: fmt.Sprintf("# Netscape HTTP Cookie File\n\n"+
+				"mangafire.to\tTRUE\t/\tTRUE\t%d\tcf_clearance\tabc\n"+
+				"#HttpOnly_.mangafire.to\tTRUE\t/\tFALSE\t0\tsession\txyz\r\n"+
+				"mangafire.to\tFALSE\t/\tFALSE\t%d\told\tgone\n"+
+				"static.mangafire.to\tFALSE\t/\tFALSE\t%[1]d\tcdn\tno\n"+
+				"mangafire.to\tFALSE\t/user\tFALSE\t%[1]d\tuser\tno\n"+
+				".google.com\tTRUE\t/\tTRUE\t%[1]d\tNID\tother\n"+
+				".ünï.mangafire.to\tTRUE\t/\tFALSE\t%[1]d\tbadhost\trejected\n", future, past),
+			want: "cf_clearance=abc session=xyz",
+			n:    4,
+		},
+		{
+			name: "json",
+			data: fmt.Sprintf(`[
+				{"domain": "mangafire.to", "hostOnly": false, "path": "/", "name": "cf_clearance", "value": "abc", "secure": true, "expirationDate": %d.5},
+				{"domain": ".MangaFire.to", "hostOnly": true, "path": "/", "name": "host", "value": "only", "session": true},
+				{"domain": "static.mangafire.to", "path": "/", "name": "cdn", "value": "no", "session": true},
+				{"domain": ".mangafire.to", "name": "nopath", "value": "root", "session": true},
+				{"domain": ".mangafire.to", "path": "/", "name": "old", "value": "gone", "expirationDate": %d},
+				{"domain": ".notmangafire.to", "path": "/", "name": "other", "value": "site", "session": true},
+				{"domain": ".ünï.mangafire.to", "path": "/", "name": "badhost", "value": "rejected", "session": true}
+			]`, future, past),
+			want: "cf_clearance=abc host=only nopath=root",
+			n:    4,
+		},
+		{
+			name: "wrapped json",
+			data: `{"cookies": [{"domain": ".mangafire.to", "path": "/", "name": "session", "value": "xyz", "session": true}]}`,
+			want: "session=xyz",
+			n:    1,
+		},
+	}
+	target, _ := url.Parse("https://mangafire.to/filter")
+	for _, tt := range tests {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "export")
+		if err := os.WriteFile(src, []byte(tt.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		for _, store := range []string{"cookies.txt", "cookies.json"} {
+			path := filepath.Join(dir, store)
+			j, err := NewFileJar(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := j.Import(src)
+			if err != nil || n != tt.n {
+				t.Errorf("%s into %s: imported %d, %v; want %d", tt.name, store, n, err, tt.n)
+			}
+			// reload from the jar's own file, which must round-trip
+			j, err = NewFileJar(path)
+			if err != nil {
+				t.Fatalf("%s: reload %s: %v", tt.name, store, err)
+			}
+			if got := cookieString(j.Cookies(target)); got != tt.want {
+				t.Errorf("%s via %s: cookies = %q, want %q", tt.name, store, got, tt.want)
+			}
+			data, _ := os.ReadFile(path)
+			for _, dropped := range []string{"NID", "other", "badhost"} {
+				if strings.Contains(string(data), dropped) {
+					t.Errorf("%s into %s: %s cookie persisted", tt.name, store, dropped)
+				}
+			}
+		}
+	}
+
+	j, _ := NewFileJar(filepath.Join(t.TempDir(), "cookies.txt"))
+	if _, err := j.Import(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing export imported")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.txt")
+	os.WriteFile(bad, []byte("mangafire.to\tTRUE\t/\n"), 0o600)
+	if _, err := j.Import(bad); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("malformed line: err = %v", err)
+	}
+}
+
+func TestFileJarSetCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	j, err := NewFileJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site, _ := url.Parse("https://mangafire.to/filter")
+	j.SetCookies(site, []*http.Cookie{
+		{Name: "session", Value: "1", MaxAge: 3600},
+		{Name: "wide", Value: "2", Domain: ".mangafire.to", Path: "/"},
+		{Name: "foreign", Value: "3", Domain: "evil.example", Path: "/"},
+		{Name: "sibling", Value: "4", Domain: "other.to", Path: "/"},
+	})
+	j.SetCookies(site, []*http.Cookie{{Name: "wide", Value: "", MaxAge: -1, Domain: "mangafire.to", Path: "/"}})
+	if err := j.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if n := j.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1", n)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foreign", "sibling", "wide"} {
+		if strings.Contains(string(data), `"`+name+`"`) {
+			t.Errorf("%s cookie persisted:\n%s", name, data)
+		}
+	}
+	j, err = NewFileJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cookieString(j.Cookies(site)); got != "session=1" {
+		t.Errorf("reloaded cookies = %q", got)
+	}
+	evil, _ := url.Parse("https://evil.example/")
+	if got := j.Cookies(evil); len(got) != 0 {
+		t.Errorf("foreign cookie replayed: %v", got)
+	}
+
+	// the file is only rewritten when a response changes the jar
+	j.SetCookies(site, []*http.Cookie{{Name: "pinned", Value: "1", Path: "/"}})
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	j.SetCookies(site, []*http.Cookie{{Name: "pinned", Value: "1", Path: "/"}, {Name: "gone", MaxAge: -1}})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unchanged jar saved: %v", err)
+	}
+	j.SetCookies(site, []*http.Cookie{{Name: "pinned", Value: "2", Path: "/"}})
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("changed jar not saved: %v", err)
+	}
+}
+
+// cookieString lists cookies as sorted name=value pairs.
+func cookieString(cookies []*http.Cookie) string {
+	s := make([]string, len(cookies))
+	for i, c := range cookies {
+		s[i] = c.Name + "=" + c.Value
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
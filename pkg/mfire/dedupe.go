@@ -0,0 +1,295 @@
+package mfire
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chapterNumberRe finds chapter numbers in text such as "Ch. 10.5",
+// "Chapter 10,5: Title", "#12" or a bare "012". The first group is the
+// prefix, if any.
+var chapterNumberRe = regexp.MustCompile(`(?i)(\b(?:chapter|chap|ch|episode|ep)\b\.?[\s_-]*|#\s*)?(\d+(?:[.,]\d+)?)`)
+
+// ParseChapterNumber reads a chapter number written the ways the site and
+// scanlators write them: "10.5", "10,5", "010", "Ch. 10.5", "Chapter 10.5:
+// Title", "Vol.3 Chapter 20" or "#12". A number after a chapter prefix
+// wins over the others, and volume numbers are skipped. The result is
+// normalised, so "10.50" and "10.5" are the same chapter.
+func ParseChapterNumber(s string) (float64, bool) {
+	s = volumeRe.ReplaceAllString(s, " ")
+	var best []string
+	for _, m := range chapterNumberRe.FindAllStringSubmatch(s, -1) {
+		if best == nil || m[1] != "" && best[1] == "" {
+			best = m
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.Replace(best[2], ",", ".", 1), 64)
+	if err != nil {
+		return 0, false
+	}
+	return normalizeNumber(n), true
+}
+
+// normalizeNumber rounds away floating point noise, so chapter numbers
+// that are the same on paper compare equal.
+func normalizeNumber(n float64) float64 {
+	return math.Round(n*1e4) / 1e4
+}
+
+// ChapterGroup is every upload of one chapter or volume number: the same
+// chapter in several languages, re-uploads and other scanlations.
+type ChapterGroup struct {
+	Kind     string // "chapter" or "volume"
+	Number   float64
+	Chapters []Chapter // in the order given to GroupChapters
+	// Best is the upload ChapterList keeps. Client.ChapterUploads sets it;
+	// GroupChapters leaves it zero.
+	Best Chapter
+}
+
+// GroupChapters groups chapters by kind and number, newest (highest
+// number) first.
+func GroupChapters(chapters []Chapter) []ChapterGroup {
+	type key struct {
+		kind   string
+		number float64
+	}
+	index := make(map[key]int)
+	var groups []ChapterGroup
+	for _, ch := range chapters {
+		k := key{ch.Kind, normalizeNumber(ch.Number)}
+		if k.kind == "" {
+			k.kind = "chapter"
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, ChapterGroup{Kind: k.kind, Number: k.number})
+		}
+		groups[i].Chapters = append(groups[i].Chapters, ch)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Number > groups[j].Number })
+	return groups
+}
+
+// DedupeRule is one criterion for choosing between uploads of the same
+// chapter.
+type DedupeRule string
+
+const (
+	// PreferLanguage picks the upload whose language ranks highest in
+	// DedupePolicy.Languages.
+	PreferLanguage DedupeRule = "language"
+	// PreferNewest picks the most recently released upload.
+	PreferNewest DedupeRule = "newest"
+	// PreferMostPages picks the upload with the most pages. Page counts
+	// are only known after Client.CountPages, which Client.Dedupe calls.
+	PreferMostPages DedupeRule = "pages"
+)
+
+// DefaultDedupeRules keeps the language preferences first and takes the
+// newest upload among those in the same language.
+var DefaultDedupeRules = []DedupeRule{PreferLanguage, PreferNewest}
+
+// ParseDedupeRules parses a comma-separated list of rules, such as
+// "language,pages,newest".
+func ParseDedupeRules(s string) ([]DedupeRule, error) {
+	var rules []DedupeRule
+	for _, r := range strings.Split(s, ",") {
+		switch rule := DedupeRule(strings.ToLower(strings.TrimSpace(r))); rule {
+		case PreferLanguage, PreferNewest, PreferMostPages:
+			rules = append(rules, rule)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown dedupe rule %q (want language, newest or pages)", r)
+		}
+	}
+	return rules, nil
+}
+
+// DedupePolicy chooses one upload of each chapter.
+type DedupePolicy struct {
+	// Languages ranks languages, most preferred first. Regional variants
+	// rank just after their language's exact match; languages not listed
+	// rank last.
+	Languages []Language
+	// Rules are tried in order until one upload beats the others; the
+	// order of the uploads settles what is left. Empty means
+	// DefaultDedupeRules.
+	Rules []DedupeRule
+}
+
+func (p DedupePolicy) rules() []DedupeRule {
+	if len(p.Rules) == 0 {
+		return DefaultDedupeRules
+	}
+	return p.Rules
+}
+
+// languageRank orders l by the policy's languages, lower first.
+func (p DedupePolicy) languageRank(l Language) int {
+	for i, pref := range p.Languages {
+		if l == pref {
+			return 2 * i
+		}
+	}
+	for i, pref := range p.Languages {
+		if l.Family() == pref.Family() {
+			return 2*i + 1
+		}
+	}
+	return 2 * len(p.Languages)
+}
+
+// better reports whether a is preferred over b.
+func (p DedupePolicy) better(a, b Chapter) bool {
+	for _, r := range p.rules() {
+		switch r {
+		case PreferLanguage:
+			if ra, rb := p.languageRank(a.Language), p.languageRank(b.Language); ra != rb {
+				return ra < rb
+			}
+		case PreferNewest:
+			if !a.Date.Equal(b.Date) {
+				return a.Date.After(b.Date)
+			}
+		case PreferMostPages:
+			if a.PageCount != b.PageCount {
+				return a.PageCount > b.PageCount
+			}
+		}
+	}
+	return false
+}
+
+// Best returns the preferred upload of a group.
+func (p DedupePolicy) Best(uploads []Chapter) Chapter {
+	var best Chapter
+	for i, ch := range uploads {
+		if i == 0 || p.better(ch, best) {
+			best = ch
+		}
+	}
+	return best
+}
+
+// Dedupe keeps the preferred upload of every chapter and volume number,
+// newest first.
+func (p DedupePolicy) Dedupe(chapters []Chapter) []Chapter {
+	groups := GroupChapters(chapters)
+	out := make([]Chapter, len(groups))
+	for i, g := range groups {
+		out[i] = p.Best(g.Chapters)
+	}
+	return out
+}
+
+// DedupeLatest keeps the preferred link of every kind and number shown on
+// a listing card, in the order given, for callers that want one link per
+// chapter rather than one per language. Cards show no page counts, so
+// PreferMostPages has no effect there.
+func (p DedupePolicy) DedupeLatest(latest []LatestChapter) []LatestChapter {
+	type key struct {
+		kind   string
+		number float64
+	}
+	index := make(map[key]int)
+	var out []LatestChapter
+	for _, lc := range latest {
+		n, _ := strconv.ParseFloat(lc.Number, 64)
+		k := key{lc.Kind, normalizeNumber(n)}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(out)
+			out = append(out, lc)
+			continue
+		}
+		if p.better(Chapter{Language: lc.Language, Date: lc.Date}, Chapter{Language: out[i].Language, Date: out[i].Date}) {
+			out[i] = lc
+		}
+	}
+	return out
+}
+
+// needsPages reports whether the policy compares page counts.
+func (p DedupePolicy) needsPages() bool {
+	for _, r := range p.rules() {
+		if r == PreferMostPages {
+			return true
+		}
+	}
+	return false
+}
+
+// WithDedupeRules sets the rules ChapterList and VolumeList use to pick
+// one upload of each chapter, with languages ranked by the Client's
+// preferences. Without it they use DefaultDedupeRules. Leaving out
+// PreferLanguage lets the other rules choose across languages, though
+// languages outside the preferences are still left out. Rules including
+// PreferMostPages make the lists fetch the pages of every duplicated
+// chapter.
+func WithDedupeRules(rules ...DedupeRule) Option {
+	return func(c *Client) {
+		c.dedupeRules = append([]DedupeRule(nil), rules...)
+	}
+}
+
+// CountPages sets the PageCount of chapters not counted yet, fetching
+// their page lists.
+func (c *Client) CountPages(ctx context.Context, chapters []Chapter) error {
+	for i := range chapters {
+		if chapters[i].PageCount > 0 {
+			continue
+		}
+		pages, err := c.Pages(ctx, chapters[i])
+		if err != nil {
+			return err
+		}
+		chapters[i].PageCount = len(pages)
+	}
+	return nil
+}
+
+// Dedupe is DedupePolicy.Dedupe, counting the pages of duplicated
+// chapters first when the policy prefers the most pages. Chapters
+// uploaded once are never fetched.
+func (c *Client) Dedupe(ctx context.Context, chapters []Chapter, p DedupePolicy) ([]Chapter, error) {
+	groups := GroupChapters(chapters)
+	if err := c.pickBest(ctx, groups, p); err != nil {
+		return nil, err
+	}
+	return bestOf(groups), nil
+}
+
+// pickBest sets the Best upload of each group, counting the pages of
+// duplicated chapters first when p prefers the most pages.
+func (c *Client) pickBest(ctx context.Context, groups []ChapterGroup, p DedupePolicy) error {
+	for i := range groups {
+		g := &groups[i]
+		if len(g.Chapters) > 1 && p.needsPages() {
+			if err := c.CountPages(ctx, g.Chapters); err != nil {
+				return err
+			}
+		}
+		g.Best = p.Best(g.Chapters)
+	}
+	return nil
+}
+
+// bestOf returns the Best upload of each group.
+func bestOf(groups []ChapterGroup) []Chapter {
+	out := make([]Chapter, len(groups))
+	for i, g := range groups {
+		out[i] = g.Best
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package mfire
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseChapterNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"10.5", 10.5, true},
+		{"10,5", 10.5, true},
+		{"010", 10, true},
+		{"10.50", 10.5, true},
+		{"Ch. 10.5", 10.5, true},
+		{"Chapter 1100: Luffy's Dream", 1100, true},
+		{"Vol.3 Chapter 20", 20, true},
+		{"Volume 2 - 15", 15, true},
+		{"Season 2 Ep.7", 7, true},
+		{"Part 2 #12", 12, true},
+		{"1097.5000001", 1097.5, true},
+		{"Extra", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseChapterNumber(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseChapterNumber(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDedupePolicy(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 11, d, 0, 0, 0, 0, time.UTC) }
+	uploads := []Chapter{
+		{ID: "en-10", Number: 10, Language: English, Date: day(1), PageCount: 18},
+		{ID: "es-10", Number: 10, Language: Spanish, Date: day(3), PageCount: 20},
+		{ID: "la-10", Number: 10, Language: SpanishLatAm, Date: day(2), PageCount: 22},
+		{ID: "en-10b", Number: 10.0000001, Language: English, Date: day(4), PageCount: 17},
+		{ID: "en-9", Number: 9, Language: English, Date: day(1)},
+		{ID: "vol-10", Kind: "volume", Number: 10, Language: English},
+		{ID: "en-10.5", Number: 10.5, Language: English},
+	}
+	groups := GroupChapters(uploads)
+	var got []string
+	for _, g := range groups {
+		got = append(got, fmt.Sprintf("%s %s:%d", g.Kind, FormatNumber(g.Number), len(g.Chapters)))
+	}
+	if want := "chapter 10.5:1, chapter 10:4, volume 10:1, chapter 9:1"; strings.Join(got, ", ") != want {
+		t.Errorf("groups = %s, want %s", strings.Join(got, ", "), want)
+	}
+
+	tests := []struct {
+		policy DedupePolicy
+		want   string
+	}{
+		{DedupePolicy{Languages: []Language{English, Spanish}}, "en-10b"},
+		{DedupePolicy{Languages: []Language{Spanish, English}}, "es-10"},
+		{DedupePolicy{Languages: []Language{SpanishLatAm, English}}, "la-10"},
+		{DedupePolicy{Languages: []Language{"fr"}}, "en-10b"},
+		{DedupePolicy{Languages: []Language{Spanish}, Rules: []DedupeRule{PreferMostPages}}, "la-10"},
+		{DedupePolicy{Languages: []Language{English}, Rules: []DedupeRule{PreferLanguage, PreferMostPages}}, "en-10"},
+		{DedupePolicy{Rules: []DedupeRule{PreferNewest}}, "en-10b"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Best(groups[1].Chapters); got.ID != tt.want {
+			t.Errorf("%v %v picked %s, want %s", tt.policy.Languages, tt.policy.Rules, got.ID, tt.want)
+		}
+	}
+
+	var ids []string
+	for _, ch := range (DedupePolicy{Languages: []Language{Spanish}}).Dedupe(uploads) {
+		ids = append(ids, ch.ID)
+	}
+	if want := "en-10.5 es-10 vol-10 en-9"; strings.Join(ids, " ") != want {
+		t.Errorf("Dedupe = %s, want %s", strings.Join(ids, " "), want)
+	}
+
+	latest := []LatestChapter{
+		{Kind: "chapter", Number: "10", Language: English, Date: day(1)},
+		{Kind: "chapter", Number: "10", Language: Spanish, Date: day(3)},
+		{Kind: "volume", Number: "10", Language: English},
+		{Kind: "chapter", Number: "9.5", Language: Spanish},
+		{Kind: "chapter", Number: "10.0", Language: English, Date: day(2)},
+	}
+	var shown []string
+	for _, lc := range (DedupePolicy{Languages: []Language{English}}).DedupeLatest(latest) {
+		shown = append(shown, lc.Kind+" "+lc.Number+" "+string(lc.Language))
+	}
+	if want := "chapter 10.0 en, volume 10 en, chapter 9.5 es"; strings.Join(shown, ", ") != want {
+		t.Errorf("DedupeLatest = %s, want %s", strings.Join(shown, ", "), want)
+	}
+
+	if rules, err := ParseDedupeRules(" Pages,newest "); err != nil || len(rules) != 2 || rules[0] != PreferMostPages {
+		t.Errorf("ParseDedupeRules = %v, %v", rules, err)
+	}
+	if _, err := ParseDedupeRules("language,best"); err == nil {
+		t.Error("unknown rule accepted")
+	}
+}
+
+func TestClientDedupe(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	// a chapter has as many pages as the length of its ID
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		id := strings.TrimPrefix(req.URL.Path, "/ajax/read/chapter/")
+		mu.Lock()
+		fetched = append(fetched, id)
+		mu.Unlock()
+		images := make([]string, len(id))
+		for i := range images {
+			images[i] = fmt.Sprintf(`["https://img.test/%s/%d.png",1,0]`, id, i)
+		}
+		body := `{"status":200,"result":{"images":[` + strings.Join(images, ",") + `]}}`
+		return &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{},
+			Body: io.NopCloser(bytes.NewReader([]byte(body))), Request: req}, nil
+	})
+	c := NewClient(WithTransport(rt))
+	chapters := []Chapter{
+		{ID: "a", Number: 2, Language: English},
+		{ID: "bbb", Number: 2, Language: English},
+		{ID: "cc", Number: 2, Language: English},
+		{ID: "once", Number: 1, Language: English},
+	}
+	p := DedupePolicy{Rules: []DedupeRule{PreferMostPages}}
+	out, err := c.Dedupe(context.Background(), chapters, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].ID != "bbb" || out[0].PageCount != 3 || out[1].ID != "once" {
+		t.Errorf("Dedupe = %+v", out)
+	}
+	if got := strings.Join(fetched, " "); got != "a bbb cc" {
+		t.Errorf("fetched %s, want only the duplicates", got)
+	}
+
+	fetched = nil
+	if _, err := c.Dedupe(context.Background(), chapters, DedupePolicy{}); err != nil || len(fetched) != 0 {
+		t.Errorf("default rules fetched %v, err %v", fetched, err)
+	}
+}
+
+func TestParserChaptersDuplicates(t *testing.T) {
+	// two uploads of chapter 5, listed in the same order by both endpoints
+	list := `{"status":200,"result":"` +
+		`<li class=\"item\" data-number=\"5\"><a href=\"/read/x.abc/en/chapter-5\"><span>Chapter 5</span><span>Nov 24, 2023</span></a></li>` +
+		`<li class=\"item\" data-number=\"5.0\"><a href=\"/read/x.abc/en/chapter-5\"><span>Chapter 5</span><span>Nov 20, 2023</span></a></li>` +
+		`<li class=\"item\" data-number=\"4,5\"><a href=\"/read/x.abc/en/chapter-4.5\"><span>Chapter 4.5</span><span>Nov 10, 2023</span></a></li>"}`
+	read := `{"status":200,"result":{"html":"` +
+		`<a href=\"/read/x.abc/en/chapter-5\" data-number=\"5\" data-id=\"52\">Chapter 5</a>` +
+		`<a href=\"/read/x.abc/en/chapter-5\" data-number=\"5\" data-id=\"51\">Chapter 5</a>` +
+		`<a data-id=\"45\" title=\"Ch. 4.5: Extra\">Ch. 4.5: Extra</a>"}}`
+	chapters, err := NewParser(nil).Chapters(MangaRef{ID: "abc", Slug: "x"}, English, []byte(list), []byte(read))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 3 {
+		t.Fatalf("got %d chapters, want 3", len(chapters))
+	}
+	for i, want := range []struct {
+		id     string
+		number float64
+		day    int
+	}{{"52", 5, 24}, {"51", 5, 20}, {"45", 4.5, 10}} {
+		ch := chapters[i]
+		if ch.ID != want.id || ch.Number != want.number || ch.Date.Day() != want.day {
+			t.Errorf("chapters[%d] = %s %v %v, want %s %v day %d", i, ch.ID, ch.Number, ch.Date, want.id, want.number, want.day)
+		}
+	}
+	if best := (DedupePolicy{}).Dedupe(chapters); len(best) != 2 || best[0].ID != "52" {
+		t.Errorf("Dedupe = %+v", best)
+	}
+}
@@ -0,0 +1,57 @@
+package mfire
+
+import (
+	"image"
+	"image/draw"
+)
+
+// descramble restores an image the site serves with its tiles shuffled.
+// The image is cut into a grid of tiles at most 200px square (about a fifth
+// of each side); every tile but those in the last row and column was moved
+// according to offset, the key sent along with the page URL.
+func descramble(src image.Image, offset int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	pw, ph := pieceSize(w), pieceSize(h)
+	xMax, yMax := ceilDiv(w, pw)-1, ceilDiv(h, ph)-1
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y <= yMax; y++ {
+		for x := 0; x <= xMax; x++ {
+			xDst, yDst := pw*x, ph*y
+			tw, th := pw, ph
+			if w-xDst < tw {
+				tw = w - xDst
+			}
+			if h-yDst < th {
+				th = h - yDst
+			}
+			xSrc, ySrc := pw*x, ph*y
+			if x < xMax {
+				xSrc = pw * ((xMax - x + offset) % xMax)
+			}
+			if y < yMax {
+				ySrc = ph * ((yMax - y + offset) % yMax)
+			}
+			r := image.Rect(xDst, yDst, xDst+tw, yDst+th)
+			draw.Draw(dst, r, src, b.Min.Add(image.Pt(xSrc, ySrc)), draw.Src)
+		}
+	}
+	return dst
+}
+
+// pieceSize returns the tile size along a side of length n.
+func pieceSize(n int) int {
+	s := ceilDiv(n, 5)
+	if s > 200 {
+		s = 200
+	}
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,87 @@
+package mfire
+
+import (
+	"context"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Details fetches the detail page of manga.
+func (c *Client) Details(ctx context.Context, manga MangaRef) (*Details, error) {
+	doc, err := c.fetchDocument(ctx, manga.URL())
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.parser.Details(doc)
+	if d != nil {
+		if d.ID == "" {
+			d.ID = manga.ID
+		}
+		d.Slug, d.Url = manga.Slug, manga.URL()
+	}
+	return d, err
+}
+
+// Details parses a manga's detail page. The title is required; everything
+// else is filled in when present.
+func (p *Parser) Details(doc *goquery.Document) (*Details, error) {
+	d := newDiag("detail")
+	page := p.find(d, doc.Selection, "detail")
+	out := &Details{
+		Title:       cleanText(p.find(d, page, "detail.title").First().Text()),
+		Cover:       absURL(imgSrc(p.find(d, page, "detail.cover"))),
+		Status:      cleanText(p.find(d, page, "detail.status").First().Text()),
+		Type:        cleanText(p.find(d, page, "detail.type").First().Text()),
+		Rating:      parseRating(p.find(d, page, "detail.rating").First().Text()),
+		Description: cleanParagraphs(p.find(d, page, "detail.description").First().Text()),
+	}
+	out.MangaRef.ID = page.AttrOr("data-id", "")
+	if alt := p.find(d, page, "detail.alt").First().Text(); alt != "" {
+		for _, t := range strings.Split(alt, ";") {
+			if t = cleanText(t); t != "" && t != out.Title {
+				out.AltTitles = append(out.AltTitles, t)
+			}
+		}
+	}
+	// the modal holds the untruncated synopsis
+	if s := cleanParagraphs(p.find(d, doc.Selection, "synopsis").First().Text()); len(s) > len(out.Description) {
+		out.Description = s
+	}
+	p.find(d, page, "detail.meta").Each(func(_ int, row *goquery.Selection) {
+		spans := row.ChildrenFiltered("span")
+		label := strings.ToLower(strings.TrimSuffix(cleanText(spans.First().Text()), ":"))
+		value := spans.Eq(1)
+		var links []string
+		value.Find("a").Each(func(_ int, a *goquery.Selection) {
+			if t := cleanText(a.Text()); t != "" {
+				links = append(links, t)
+			}
+		})
+		switch label {
+		case "author", "authors":
+			out.Authors = links
+		case "genres", "genre":
+			out.Genres = links
+		case "mangazines", "magazines":
+			out.Magazines = links
+		case "published":
+			out.Published = cleanText(value.Text())
+		}
+	})
+	out.Languages, _ = p.MangaLanguages(doc)
+	d.require("detail", "detail.title")
+	return out, d.err()
+}
+
+// cleanParagraphs trims s and collapses whitespace within paragraphs,
+// keeping blank-line paragraph breaks.
+func cleanParagraphs(s string) string {
+	var paras []string
+	for _, para := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n\n") {
+		if para = cleanText(para); para != "" {
+			paras = append(paras, para)
+		}
+	}
+	return strings.Join(paras, "\n\n")
+}
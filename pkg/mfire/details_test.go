@@ -0,0 +1,77 @@
+package mfire
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParserDetails(t *testing.T) {
+	d, err := NewParser(nil).Details(loadFixture(t, "detail.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, _ := ParseMangaURL(DefaultFixtureOptions.MangaPath)
+	if d.ID != ref.ID || d.Title == "" || !strings.HasPrefix(d.Cover, "https://") || d.Type == "" || d.Status == "" {
+		t.Errorf("details = %+v", d)
+	}
+	if d.Description == "" || d.Published == "" || len(d.Authors) == 0 || len(d.Genres) == 0 {
+		t.Errorf("description %q, published %q, authors %q, genres %q", d.Description, d.Published, d.Authors, d.Genres)
+	}
+	for _, list := range [][]string{d.AltTitles, d.Authors, d.Genres, d.Magazines} {
+		for _, s := range list {
+			if s == "" || s != strings.TrimSpace(s) {
+				t.Errorf("untrimmed entry %q", s)
+			}
+		}
+	}
+	if len(d.Languages) == 0 {
+		t.Error("no languages")
+	}
+
+	// the fields of one page, exactly
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div id="manga-page" data-id="dkw">
+		<div class="poster"><div><img src="https://static.mfcdn.nl/1/c0/op.jpg" alt="One Piece"></div></div>
+		<div class="info">
+			<p>Releasing</p>
+			<h1> One Piece </h1>
+			<h6>ワンピース; One Piece; Budak Getah</h6>
+			<div class="min-info"><a href="/type/manga">Manga</a><span><i class="fa-solid fa-star"></i> 8.94</span></div>
+		</div>
+		<div class="description">Gol D. Roger was known as the Pirate King...</div>
+		<div class="meta">
+			<div><span>Author:</span> <span><a href="/author/oda-eiichiro">Oda Eiichiro</a></span></div>
+			<div><span>Published:</span> <span>Jul 22, 1997 to ?</span></div>
+			<div><span>Genres:</span> <span><a href="/genre/action">Action</a>, <a href="/genre/shounen">Shounen</a></span></div>
+			<div><span>Mangazines:</span> <span><a href="/magazine/weekly-shounen-jump">Weekly Shounen Jump</a></span></div>
+		</div>
+	</div>
+	<div id="synopsis"><div class="modal-content">
+		Gol D. Roger was known as the   Pirate King.
+
+		Twenty-two years later, Luffy sets out.
+	</div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = NewParser(nil).Details(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != "dkw" || d.Title != "One Piece" || d.Status != "Releasing" || d.Type != "Manga" || d.Rating != 8.94 ||
+		d.Cover != "https://static.mfcdn.nl/1/c0/op.jpg" {
+		t.Errorf("details = %+v", d)
+	}
+	if want := []string{"ワンピース", "Budak Getah"}; !reflect.DeepEqual(d.AltTitles, want) {
+		t.Errorf("alt titles = %q, want %q", d.AltTitles, want)
+	}
+	if !reflect.DeepEqual(d.Authors, []string{"Oda Eiichiro"}) || !reflect.DeepEqual(d.Genres, []string{"Action", "Shounen"}) ||
+		!reflect.DeepEqual(d.Magazines, []string{"Weekly Shounen Jump"}) || d.Published != "Jul 22, 1997 to ?" {
+		t.Errorf("authors %q, genres %q, magazines %q, published %q", d.Authors, d.Genres, d.Magazines, d.Published)
+	}
+	if d.Description != "Gol D. Roger was known as the Pirate King.\n\nTwenty-two years later, Luffy sets out." {
+		t.Errorf("description = %q, want the full synopsis", d.Description)
+	}
+}
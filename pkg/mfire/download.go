@@ -0,0 +1,340 @@
+package mfire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+// ErrNoPages is returned when the site lists no images for a chapter.
+var ErrNoPages = errors.New("mfire: chapter has no pages")
+
+// Progress reports a finished page of a chapter download.
+type Progress struct {
+	Chapter Chapter
+	Page    int    // 1-based page number
+	Done    int    // pages finished so far, failed ones included
+	Total   int    // pages in the chapter
+	File    string // path written, empty on failure
+	Skipped bool   // already downloaded by an earlier run
+	Err     error
+}
+
+// Downloader fetches the page images of chapters through a Client, so it
+// shares the Client's transport, proxies, cookies, header profile and rate
+// limiter.
+type Downloader struct {
+	Client *Client
+	// Workers is the number of pages fetched concurrently. Defaults to 4.
+	Workers int
+	// Retries is how many times a failed page is tried again. Defaults to 2;
+	// negative disables retries.
+	Retries int
+	// JPEGQuality is used when a descrambled page is re-encoded as JPEG.
+	// Defaults to 90.
+	JPEGQuality int
+	// Process, when set, converts pages after they are downloaded and
+	// before DownloadCBZ, DownloadEPUB, DownloadPDF or DownloadProcessed
+	// save them. Download and DownloadPages keep the pages as served.
+	Process *ImageProfile
+	// Progress, when set, is called after every page. Calls are serialised
+	// but come from the worker goroutines, so it should return quickly.
+	Progress func(Progress)
+}
+
+// NewDownloader returns a Downloader using c with default settings.
+func NewDownloader(c *Client) *Downloader {
+	return &Downloader{Client: c}
+}
+
+// Download fetches every page of ch into dir, creating it if needed, and
+// returns the files written in page order. Files are named by page number,
+// zero-padded to at least three digits ("001.jpg"), with the extension of
+// the decoded format. Scrambled pages are descrambled; every page is decoded
+// before it is written, so a truncated or corrupt image fails the page
+// instead of ending up on disk. When pages fail, the others are still
+// written and the first error is returned.
+//
+// Progress is recorded in a manifest in dir (see Manifest), so running
+// Download or Resume again on the same directory skips the pages already
+// there and re-fetches only missing or damaged ones.
+func (d *Downloader) Download(ctx context.Context, ch Chapter, dir string) ([]string, error) {
+	pages, err := d.Client.Pages(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPages, ch.ID)
+	}
+	return d.DownloadPages(ctx, ch, pages, dir)
+}
+
+// DownloadPages is Download with the page list already fetched.
+func (d *Downloader) DownloadPages(ctx context.Context, ch Chapter, pages []Page, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	workers := d.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	if workers > len(pages) {
+		workers = len(pages)
+	}
+	width := len(strconv.Itoa(len(pages)))
+	if width < 3 {
+		width = 3
+	}
+
+	files := make([]string, len(pages))
+	errs := make([]error, len(pages))
+	man := openManifest(dir, ch, pages)
+	var todo []int
+	for i := range pages {
+		if man.verified(dir, i) {
+			files[i] = filepath.Join(dir, man.Pages[i].File)
+		} else {
+			man.invalidate(i)
+			todo = append(todo, i)
+		}
+	}
+	if err := man.Save(dir); err != nil {
+		return nil, err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	report := func(i int, skipped bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if d.Progress != nil {
+			d.Progress(Progress{Chapter: ch, Page: i + 1, Done: done, Total: len(pages), File: files[i], Skipped: skipped, Err: errs[i]})
+		}
+	}
+	for i := range pages {
+		if files[i] != "" {
+			report(i, true)
+		}
+	}
+
+	jobs := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				base := filepath.Join(dir, fmt.Sprintf("%0*d", width, i+1))
+				path, data, err := d.page(ctx, ch, pages[i], base)
+				if err == nil {
+					err = man.finish(dir, i, path, data)
+				}
+				if err != nil {
+					path, err = "", fmt.Errorf("page %d: %w", i+1, err)
+				}
+				files[i], errs[i] = path, err
+				report(i, false)
+			}
+		}()
+	}
+feed:
+	for _, i := range todo {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return files, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return files, err
+		}
+	}
+	man.mu.Lock()
+	man.Complete = true
+	man.mu.Unlock()
+	return files, man.Save(dir)
+}
+
+// downloadExport downloads chapters into a staging directory next to path,
+// one subdirectory per chapter, applies the Process profile and hands the
+// pages to write. The staging directory is removed once write succeeds;
+// after a failure it is kept, so the next attempt at the same path resumes
+// instead of starting over. details may be nil; it gives the reading
+// direction for split spreads.
+func (d *Downloader) downloadExport(ctx context.Context, chapters []Chapter, details *Details, path string, write func([]ExportChapter) error) error {
+	if len(chapters) == 0 {
+		return ErrNoChapters
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	staging := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".pages")
+	export := make([]ExportChapter, 0, len(chapters))
+	for i, ch := range chapters {
+		dir := filepath.Join(staging, fmt.Sprintf("%03d", i+1))
+		files, err := d.Download(ctx, ch, dir)
+		if err != nil {
+			return err
+		}
+		if d.Process != nil {
+			processed := dir + ".processed"
+			if err := os.RemoveAll(processed); err != nil {
+				return err
+			}
+			if files, err = ProcessPages(files, processed, *d.Process, details.RightToLeft()); err != nil {
+				return err
+			}
+		}
+		export = append(export, ExportChapter{Chapter: ch, Files: files})
+	}
+	if err := write(export); err != nil {
+		return err
+	}
+	return os.RemoveAll(staging)
+}
+
+// DownloadProcessed downloads ch and saves its pages converted by the
+// Process profile into dir, named like Download names them. Without a
+// profile it is Download. The pages as served are staged in a hidden
+// directory next to dir until the conversion is done. details may be nil.
+func (d *Downloader) DownloadProcessed(ctx context.Context, ch Chapter, details *Details, dir string) ([]string, error) {
+	if d.Process == nil {
+		return d.Download(ctx, ch, dir)
+	}
+	var files []string
+	err := d.downloadExport(ctx, []Chapter{ch}, details, dir, func(export []ExportChapter) error {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		for _, f := range export[0].Files {
+			path := filepath.Join(dir, filepath.Base(f))
+			if err := os.Rename(f, path); err != nil {
+				return err
+			}
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// page downloads one page to base plus the extension of its format,
+// retrying transient failures. It returns the path and the bytes written.
+func (d *Downloader) page(ctx context.Context, ch Chapter, pg Page, base string) (string, []byte, error) {
+	retries := d.Retries
+	if retries == 0 {
+		retries = 2
+	}
+	for attempt := 0; ; attempt++ {
+		data, ext, err := d.fetchPage(ctx, ch, pg)
+		if err == nil {
+			path := base + ext
+			return path, data, writeFileAtomic(path, data, 0o644)
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return "", nil, err
+		}
+		var se *StatusError
+		if errors.As(err, &se) && se.Code < 500 && se.Code != 429 {
+			return "", nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * time.Second):
+		}
+	}
+}
+
+// fetchPage fetches, verifies and if needed descrambles one page, returning
+// the bytes to write and their file extension.
+func (d *Downloader) fetchPage(ctx context.Context, ch Chapter, pg Page) ([]byte, string, error) {
+	data, err := d.Client.fetchImage(ctx, pg.Url, ch.Url)
+	if err != nil {
+		return nil, "", err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode %s: %w", pg.Url, err)
+	}
+	if !pg.Scrambled() {
+		return data, imageExt(format), nil
+	}
+	var buf bytes.Buffer
+	ext, err := encodeImage(&buf, descramble(img, pg.Offset), format, d.JPEGQuality)
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ext, nil
+}
+
+// encodeImage encodes img in the format it was decoded from where the
+// standard library can write it (PNG, GIF as PNG), and as JPEG otherwise.
+// It returns the file extension to use.
+func encodeImage(w io.Writer, img image.Image, format string, quality int) (string, error) {
+	switch format {
+	case "png", "gif":
+		return ".png", png.Encode(w, img)
+	}
+	if quality <= 0 || quality > 100 {
+		quality = 90
+	}
+	return ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// imageExt maps an image.Decode format name to a file extension.
+func imageExt(format string) string {
+	switch format {
+	case "jpeg":
+		return ".jpg"
+	case "":
+		return ".img"
+	}
+	return "." + format
+}
+
+// fetchImage downloads a page image. Images bypass the response cache:
+// they're large and fetched once.
+func (c *Client) fetchImage(ctx context.Context, rawurl, referer string) ([]byte, error) {
+	if referer == "" {
+		referer = "https://mangafire.to/"
+	}
+	req, err := c.newRequest(withoutCache(ctx), rawurl, referer)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "image/avif,image/webp,image/apng,image/*,*/*;q=0.8")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return io.ReadAll(resp.Body)
+}
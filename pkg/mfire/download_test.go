@@ -0,0 +1,137 @@
+package mfire
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gradient returns an image whose every pixel is distinct.
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+		}
+	}
+	return img
+}
+
+func TestDescramble(t *testing.T) {
+	// 23x12: 5x3 pixel tiles, with a narrower last column
+	src := gradient(23, 12)
+	got := descramble(src, 3)
+	if got.Bounds() != src.Bounds() {
+		t.Fatalf("bounds = %v, want %v", got.Bounds(), src.Bounds())
+	}
+	// xMax = 4, yMax = 3: tile (0,0) comes from ((4-0+3)%4, (3-0+3)%3) = (3,0)
+	tests := []struct{ dx, dy, sx, sy int }{
+		{0, 0, 15, 0},
+		{5, 3, 10, 6},
+		{20, 0, 20, 0}, // last column stays
+		{0, 9, 15, 9},  // last row stays
+		{22, 11, 22, 11},
+	}
+	for _, tt := range tests {
+		if g, w := got.At(tt.dx, tt.dy), src.At(tt.sx, tt.sy); g != w {
+			t.Errorf("pixel (%d,%d) = %v, want source (%d,%d) %v", tt.dx, tt.dy, g, tt.sx, tt.sy, w)
+		}
+	}
+}
+
+func TestDownloaderDownloadPages(t *testing.T) {
+	var plain, scrambled bytes.Buffer
+	if err := png.Encode(&plain, gradient(40, 60)); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&scrambled, gradient(50, 50)); err != nil {
+		t.Fatal(err)
+	}
+	var flaky int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cc := r.Header.Get("Cache-Control"); cc != "" {
+			t.Errorf("%s sent Cache-Control: %s", r.URL.Path, cc)
+		}
+		switch r.URL.Path {
+		case "/plain.png":
+			w.Write(plain.Bytes())
+		case "/scrambled.png":
+			w.Write(scrambled.Bytes())
+		case "/flaky.png":
+			if atomic.AddInt32(&flaky, 1) == 1 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write(plain.Bytes())
+		case "/truncated.png":
+			w.Write(plain.Bytes()[:plain.Len()/2])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	pages := []Page{
+		{Url: srv.URL + "/plain.png"},
+		{Url: srv.URL + "/scrambled.png", Offset: 2},
+		{Url: srv.URL + "/flaky.png"},
+		{Url: srv.URL + "/truncated.png"},
+	}
+	dir := t.TempDir()
+	var calls int32
+	cache := NewMemoryCache(0)
+	d := NewDownloader(NewClient(WithCache(cache, time.Hour)))
+	d.Workers = 2
+	d.Retries = 1
+	d.Progress = func(p Progress) {
+		atomic.AddInt32(&calls, 1)
+		if p.Total != 4 {
+			t.Errorf("progress total = %d", p.Total)
+		}
+	}
+	files, err := d.DownloadPages(context.Background(), Chapter{ID: "1"}, pages, dir)
+	if err == nil || !strings.Contains(err.Error(), "page 4") {
+		t.Errorf("err = %v, want page 4 to fail", err)
+	}
+	if calls != 4 {
+		t.Errorf("progress called %d times, want 4", calls)
+	}
+	want := []string{"001.png", "002.png", "003.png", ""}
+	for i, f := range files {
+		if f != "" {
+			f = filepath.Base(f)
+		}
+		if f != want[i] {
+			t.Errorf("files[%d] = %q, want %q", i, f, want[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "004.png")); !os.IsNotExist(err) {
+		t.Errorf("truncated page was written")
+	}
+	if _, ok := cache.Get(pages[0].Url); ok {
+		t.Errorf("page image was cached")
+	}
+
+	f, err := os.Open(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := descramble(gradient(50, 50), 2).At(0, 0); img.At(0, 0) != want {
+		t.Errorf("scrambled page not descrambled: %v, want %v", img.At(0, 0), want)
+	}
+}
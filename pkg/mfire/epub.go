@@ -0,0 +1,338 @@
+package mfire
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoChapters is returned when an export is asked for no chapters.
+var ErrNoChapters = errors.New("mfire: no chapters to export")
+
+// ExportChapter is a downloaded chapter: its metadata and page files in
+// reading order.
+type ExportChapter struct {
+	Chapter Chapter
+	Files   []string
+}
+
+// EPUBOptions configures WriteEPUB.
+type EPUBOptions struct {
+	// Title overrides the book title, which defaults to the series title
+	// followed by the chapter or chapter range.
+	Title string
+	// Device, when set, scales pages to its screen and converts them to
+	// grayscale if it is an e-ink device. Otherwise pages are kept as they
+	// are (WebP pages are always converted to JPEG, which EPUB requires).
+	Device *DeviceProfile
+}
+
+// WriteEPUB writes chapters as a fixed-layout EPUB 3 book at path: one page
+// per image, the first image doubling as the cover, a navigation entry per
+// chapter and OPF metadata from details (which may be nil). Manga read
+// right to left. The book is written to a temporary file and renamed into
+// place.
+func WriteEPUB(path string, details *Details, chapters []ExportChapter, opts EPUBOptions) error {
+	if len(chapters) == 0 {
+		return ErrNoChapters
+	}
+	b := &epubBook{details: details, opts: opts}
+	for ci, ec := range chapters {
+		for pi, file := range ec.Files {
+			if err := b.addPage(ci, pi, file); err != nil {
+				return err
+			}
+		}
+	}
+	if len(b.pages) == 0 {
+		return ErrNoPages
+	}
+	b.chapters = chapters
+	return writeAtomic(path, 0o644, b.write)
+}
+
+// epubBook collects the processed pages of an EPUB being written.
+type epubBook struct {
+	details  *Details
+	opts     EPUBOptions
+	chapters []ExportChapter
+	pages    []epubPage
+}
+
+type epubPage struct {
+	chapter       int
+	id            string // e.g. "c001-p001"
+	image         []byte
+	ext, media    string
+	width, height int
+}
+
+// addPage reads a page image, converting it for the device if requested.
+func (b *epubBook) addPage(ci, pi int, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	p := epubPage{chapter: ci, id: fmt.Sprintf("c%03d-p%03d", ci+1, pi+1)}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if b.opts.Device == nil && (format == "jpeg" || format == "png" || format == "gif") {
+		p.image, p.width, p.height = data, cfg.Width, cfg.Height
+		p.ext, p.media = imageExt(format), "image/"+format
+		b.pages = append(b.pages, p)
+		return nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	quality := 90
+	if d := b.opts.Device; d != nil {
+		img = d.Apply(img)
+		quality = d.quality()
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return err
+	}
+	p.image, p.width, p.height = buf.Bytes(), img.Bounds().Dx(), img.Bounds().Dy()
+	p.ext, p.media = ".jpg", "image/jpeg"
+	b.pages = append(b.pages, p)
+	return nil
+}
+
+func (b *epubBook) title() string {
+	if b.opts.Title != "" {
+		return b.opts.Title
+	}
+	return exportTitle(b.details, b.chapters)
+}
+
+func (b *epubBook) language() string {
+	if l := b.chapters[0].Chapter.Language.ISO(); l != "" {
+		return l
+	}
+	return "en"
+}
+
+func (b *epubBook) rtl() bool {
+	return b.details.RightToLeft()
+}
+
+// write writes the EPUB container to w. The mimetype entry must come first
+// and be stored uncompressed.
+func (b *epubBook) write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	mt, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	io.WriteString(mt, "application/epub+zip")
+
+	files := []struct{ name, body string }{
+		{"META-INF/container.xml", epubContainer},
+		{"OEBPS/content.opf", b.opf()},
+		{"OEBPS/nav.xhtml", b.nav()},
+		{"OEBPS/toc.ncx", b.ncx()},
+	}
+	for _, p := range b.pages {
+		files = append(files, struct{ name, body string }{"OEBPS/pages/" + p.id + ".xhtml", b.pageXHTML(p)})
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return err
+		}
+	}
+	for _, p := range b.pages {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/images/" + p.id + p.ext, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(p.image); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func (b *epubBook) identifier() string {
+	id := "unknown"
+	if b.details != nil && b.details.ID != "" {
+		id = b.details.ID
+	} else if m := b.chapters[0].Chapter.Manga.ID; m != "" {
+		id = m
+	}
+	first, last := b.chapters[0].Chapter, b.chapters[len(b.chapters)-1].Chapter
+	return fmt.Sprintf("urn:mfire:%s:%s:%s-%s", id, first.Language, FormatNumber(first.Number), FormatNumber(last.Number))
+}
+
+func (b *epubBook) opf() string {
+	var s strings.Builder
+	e := html.EscapeString
+	first := b.pages[0]
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+`, e(b.identifier()), e(b.title()), e(b.language()))
+	if d := b.details; d != nil {
+		for _, a := range d.Authors {
+			fmt.Fprintf(&s, "    <dc:creator>%s</dc:creator>\n", e(a))
+		}
+		for _, g := range d.Genres {
+			fmt.Fprintf(&s, "    <dc:subject>%s</dc:subject>\n", e(g))
+		}
+		if d.Description != "" {
+			fmt.Fprintf(&s, "    <dc:description>%s</dc:description>\n", e(d.Description))
+		}
+		if d.Url != "" {
+			fmt.Fprintf(&s, "    <dc:source>%s</dc:source>\n", e(d.Url))
+		}
+		if d.Title != "" {
+			fmt.Fprintf(&s, "    <meta property=\"belongs-to-collection\" id=\"series\">%s</meta>\n", e(d.Title))
+			fmt.Fprintf(&s, "    <meta refines=\"#series\" property=\"collection-type\">series</meta>\n")
+		}
+	}
+	fmt.Fprintf(&s, `    <meta property="dcterms:modified">%s</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">portrait</meta>
+    <meta property="rendition:spread">none</meta>
+    <meta name="cover" content="img-%s"/>
+    <meta name="fixed-layout" content="true"/>
+    <meta name="original-resolution" content="%dx%d"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+`, time.Now().UTC().Format("2006-01-02T15:04:05Z"), first.id, first.width, first.height)
+	for i, p := range b.pages {
+		props := ""
+		if i == 0 {
+			props = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&s, "    <item id=\"img-%s\" href=\"images/%s%s\" media-type=\"%s\"%s/>\n", p.id, p.id, p.ext, p.media, props)
+		fmt.Fprintf(&s, "    <item id=\"page-%s\" href=\"pages/%s.xhtml\" media-type=\"application/xhtml+xml\"/>\n", p.id, p.id)
+	}
+	dir := "ltr"
+	if b.rtl() {
+		dir = "rtl"
+	}
+	fmt.Fprintf(&s, "  </manifest>\n  <spine toc=\"ncx\" page-progression-direction=\"%s\">\n", dir)
+	for _, p := range b.pages {
+		fmt.Fprintf(&s, "    <itemref idref=\"page-%s\"/>\n", p.id)
+	}
+	s.WriteString("  </spine>\n</package>\n")
+	return s.String()
+}
+
+// chapterStarts returns the first page of every chapter that has pages.
+func (b *epubBook) chapterStarts() []epubPage {
+	var out []epubPage
+	last := -1
+	for _, p := range b.pages {
+		if p.chapter != last {
+			out = append(out, p)
+			last = p.chapter
+		}
+	}
+	return out
+}
+
+func (b *epubBook) chapterLabel(ci int) string {
+	return exportLabel(b.chapters[ci].Chapter)
+}
+
+func (b *epubBook) nav() string {
+	var s strings.Builder
+	e := html.EscapeString
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%s</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <ol>
+`, e(b.title()))
+	for _, p := range b.chapterStarts() {
+		fmt.Fprintf(&s, "      <li><a href=\"pages/%s.xhtml\">%s</a></li>\n", p.id, e(b.chapterLabel(p.chapter)))
+	}
+	fmt.Fprintf(&s, `    </ol>
+  </nav>
+  <nav epub:type="landmarks" hidden="">
+    <ol>
+      <li><a epub:type="cover" href="pages/%s.xhtml">Cover</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+`, b.pages[0].id)
+	return s.String()
+}
+
+// ncx is the EPUB 2 table of contents, still read by older e-readers.
+func (b *epubBook) ncx() string {
+	var s strings.Builder
+	e := html.EscapeString
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="%s"/></head>
+  <docTitle><text>%s</text></docTitle>
+  <navMap>
+`, e(b.identifier()), e(b.title()))
+	for i, p := range b.chapterStarts() {
+		fmt.Fprintf(&s, "    <navPoint id=\"nav-%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"pages/%s.xhtml\"/></navPoint>\n",
+			i+1, i+1, e(b.chapterLabel(p.chapter)), p.id)
+	}
+	s.WriteString("  </navMap>\n</ncx>\n")
+	return s.String()
+}
+
+func (b *epubBook) pageXHTML(p epubPage) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+  <title>%s</title>
+  <meta name="viewport" content="width=%d, height=%d"/>
+  <style>html, body { margin: 0; padding: 0; } img { display: block; width: 100%%; height: 100%%; }</style>
+</head>
+<body>
+  <img src="../images/%s%s" alt=""/>
+</body>
+</html>
+`, p.id, p.width, p.height, p.id, p.ext)
+}
+
+// DownloadEPUB downloads chapters and writes them as one EPUB at path, with
+// metadata from details (which may be nil).
+func (d *Downloader) DownloadEPUB(ctx context.Context, chapters []Chapter, details *Details, path string, opts EPUBOptions) error {
+	return d.downloadExport(ctx, chapters, details, path, func(export []ExportChapter) error {
+		return WriteEPUB(path, details, export, opts)
+	})
+}
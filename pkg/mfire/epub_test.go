@@ -0,0 +1,119 @@
+package mfire
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct{ w, h, maxW, maxH, ww, wh int }{
+		{800, 1200, 1236, 1648, 800, 1200},
+		{2000, 3000, 1000, 2000, 1000, 1500},
+		{2000, 3000, 1500, 1200, 800, 1200},
+		{2000, 3000, 0, 1500, 1000, 1500},
+	}
+	for _, tt := range tests {
+		if w, h := fitSize(tt.w, tt.h, tt.maxW, tt.maxH); w != tt.ww || h != tt.wh {
+			t.Errorf("fitSize(%d, %d, %d, %d) = %d, %d, want %d, %d", tt.w, tt.h, tt.maxW, tt.maxH, w, h, tt.ww, tt.wh)
+		}
+	}
+}
+
+// writePages writes n PNG pages of w x h into dir.
+func writePages(t *testing.T, dir string, n, w, h int) []string {
+	t.Helper()
+	var files []string
+	for i := 0; i < n; i++ {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, gradient(w, h)); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%03d.png", i+1))
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func TestWriteEPUB(t *testing.T) {
+	dir := t.TempDir()
+	files := writePages(t, dir, 3, 60, 90)
+	details := &Details{
+		MangaRef: MangaRef{ID: "dkw", Slug: "one-piecee"}, Title: "One Piece", Type: "Manga",
+		Authors: []string{"Oda Eiichiro"}, Genres: []string{"Action"}, Description: "Pirates & treasure.",
+	}
+	chapters := []ExportChapter{
+		{Chapter: Chapter{Number: 1, Title: "Chapter 1: Romance Dawn", Language: English}, Files: files[:2]},
+		{Chapter: Chapter{Number: 2, Language: English}, Files: files[2:]},
+	}
+	device, _ := LookupDevice("kobo-clara")
+	device.Width, device.Height = 40, 50
+	path := filepath.Join(dir, "op.epub")
+	if err := WriteEPUB(path, details, chapters, EPUBOptions{Device: &device}); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if f := zr.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Errorf("first entry = %s (method %d), want stored mimetype", f.Name, f.Method)
+	}
+	entries := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		entries[f.Name] = string(data)
+	}
+
+	opf := entries["OEBPS/content.opf"]
+	for _, want := range []string{
+		"<dc:title>One Piece - Chapters 1-2</dc:title>",
+		"<dc:creator>Oda Eiichiro</dc:creator>",
+		"<dc:description>Pirates &amp; treasure.</dc:description>",
+		`<meta property="rendition:layout">pre-paginated</meta>`,
+		`page-progression-direction="rtl"`,
+		`href="images/c001-p001.jpg" media-type="image/jpeg" properties="cover-image"`,
+		`<itemref idref="page-c002-p001"/>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf lacks %s", want)
+		}
+	}
+	nav := entries["OEBPS/nav.xhtml"]
+	if !strings.Contains(nav, `<a href="pages/c001-p001.xhtml">Chapter 1: Romance Dawn</a>`) ||
+		!strings.Contains(nav, `<a href="pages/c002-p001.xhtml">Chapter 2</a>`) {
+		t.Errorf("nav.xhtml = %s", nav)
+	}
+
+	img, err := jpeg.Decode(strings.NewReader(entries["OEBPS/images/c001-p002.jpg"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 33 || b.Dy() != 50 {
+		t.Errorf("page size = %v, want 33x50", b.Size())
+	}
+	if _, ok := img.(*image.Gray); !ok {
+		t.Errorf("page is %T, want grayscale", img)
+	}
+	if !strings.Contains(entries["OEBPS/pages/c001-p002.xhtml"], `content="width=33, height=50"`) {
+		t.Errorf("page viewport doesn't match the image")
+	}
+}
@@ -0,0 +1,138 @@
+package mfire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FixtureOptions selects what RefreshFixtures records.
+type FixtureOptions struct {
+	// MangaPath is the detail page whose chapter list and first chapter are
+	// recorded, e.g. "/manga/one-piecee.dkw".
+	MangaPath string
+	// Language is the chapter language to record. Defaults to "en".
+	Language string
+	// Query is the search recorded as filter.html.
+	Query string
+	// EmptyQuery is a search expected to return nothing, recorded as
+	// filter_empty.html.
+	EmptyQuery string
+}
+
+// DefaultFixtureOptions records the pages the package's tests expect.
+var DefaultFixtureOptions = FixtureOptions{
+	MangaPath:  "/manga/one-piecee.dkw",
+	Language:   "en",
+	Query:      "one piece",
+	EmptyQuery: "zzqxv no such manga",
+}
+
+// HandWrittenFixtures lists the test corpus in testdata. None of it was
+// recorded: every file is hand-written markup modelled on the site's pages
+// and trimmed to what the parsers read, so its IDs, image URLs and dates
+// are made up. RefreshFixtures can replace most of it with live responses;
+// genre.html (the last page of a listing) and home_redesign.html (a
+// changed layout) have no live counterpart.
+var HandWrittenFixtures = []string{
+	"chapters_en.json", "detail.html", "filter.html", "filter_empty.html", "genre.html",
+	"home.html", "home_redesign.html", "quicksearch.json", "read_chapters_en.json", "reader_chapter.json",
+}
+
+// RefreshFixtures records live responses into dir under the corpus's file
+// names: the home and filter pages, the quick-search response, a detail
+// page, its chapter list and the reader response of its newest chapter. It
+// returns the files written. The tests check the structure of corpus pages
+// rather than their content, so they also pass against a recorded corpus
+// as long as the layout holds.
+func RefreshFixtures(ctx context.Context, c *Client, dir string, opts FixtureOptions) ([]string, error) {
+	if opts.Language == "" {
+		opts.Language = DefaultFixtureOptions.Language
+	}
+	ref, err := ParseMangaURL(opts.MangaPath)
+	if err != nil {
+		return nil, fmt.Errorf("fixtures: %w", err)
+	}
+	mangaID := ref.ID
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	record := func(name, rawurl, referer string) ([]byte, error) {
+		body, err := c.fetchBody(ctx, rawurl, referer)
+		if err != nil {
+			return nil, fmt.Errorf("fixtures: %s: %w", name, err)
+		}
+		path := filepath.Join(dir, name)
+		if err := writeFileAtomic(path, body, 0o644); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+		return body, nil
+	}
+	searchURL := func(q string) string {
+		vrf, _ := GenerateVrf(q)
+		return "https://mangafire.to/filter?keyword=" + url.QueryEscape(q) + "&vrf=" + url.QueryEscape(vrf)
+	}
+
+	if _, err := c.ensureSession(ctx); err != nil {
+		return written, err
+	}
+	if _, err := record("home.html", "https://mangafire.to/home", "https://mangafire.to/"); err != nil {
+		return written, err
+	}
+	if _, err := record("filter.html", searchURL(opts.Query), "https://mangafire.to/filter"); err != nil {
+		return written, err
+	}
+	if _, err := record("filter_empty.html", searchURL(opts.EmptyQuery), "https://mangafire.to/filter"); err != nil {
+		return written, err
+	}
+	vrf, _ := GenerateVrf(opts.Query)
+	if _, err := record("quicksearch.json", quickSearchURL(opts.Query, vrf), "https://mangafire.to/home"); err != nil {
+		return written, err
+	}
+	detailURL := absURL(opts.MangaPath)
+	if _, err := record("detail.html", detailURL, "https://mangafire.to/"); err != nil {
+		return written, err
+	}
+	lang := strings.ToLower(opts.Language)
+	if _, err := record("chapters_"+lang+".json",
+		"https://mangafire.to/ajax/manga/"+mangaID+"/chapter/"+lang, detailURL); err != nil {
+		return written, err
+	}
+	vrf, _ = GenerateVrf(mangaID + "@chapter@" + lang)
+	body, err := record("read_chapters_"+lang+".json",
+		"https://mangafire.to/ajax/read/"+mangaID+"/chapter/"+lang+"?vrf="+url.QueryEscape(vrf), detailURL)
+	if err != nil {
+		return written, err
+	}
+
+	// the newest chapter's id is needed to record a reader response
+	var list struct {
+		Result struct {
+			HTML string `json:"html"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return written, fmt.Errorf("fixtures: read list: %w", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(list.Result.HTML))
+	if err != nil {
+		return written, err
+	}
+	chapterID, ok := doc.Find("a[data-id]").First().Attr("data-id")
+	if !ok {
+		return written, fmt.Errorf("fixtures: read list has no chapter ids")
+	}
+	vrf, _ = GenerateVrf("chapter@" + chapterID)
+	_, err = record("reader_chapter.json",
+		"https://mangafire.to/ajax/read/chapter/"+chapterID+"?vrf="+url.QueryEscape(vrf), detailURL)
+	return written, err
+}
@@ -0,0 +1,103 @@
+package mfire
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The corpus in testdata is hand-written, but RefreshFixtures can replace
+// it with live responses, so tests of corpus pages check their structure
+// with these helpers rather than their content. Exact values are only
+// asserted for inline documents and the pages RefreshFixtures can't
+// record.
+
+var (
+	mangaURLRe = regexp.MustCompile(`^https://mangafire\.to/manga/[a-z0-9-]+\.[a-z0-9]+$`)
+	readURLRe  = regexp.MustCompile(`^https://mangafire\.to/read/[a-z0-9-]+\.[a-z0-9]+/[a-z-]+/(chapter|volume)-[0-9.]+$`)
+)
+
+// checkManga checks a listing entry parsed from a corpus page.
+func checkManga(t *testing.T, where string, m Manga) {
+	t.Helper()
+	ref, err := ParseMangaURL(m.Url)
+	if m.Title == "" || !mangaURLRe.MatchString(m.Url) || err != nil || ref.ID != m.ID || ref.Slug != m.Slug {
+		t.Errorf("%s: bad entry %+v", where, m)
+	}
+	if !strings.HasPrefix(m.Cover, "https://") {
+		t.Errorf("%s: %s cover = %q", where, m.Title, m.Cover)
+	}
+	for _, lc := range m.Latest {
+		checkLatest(t, where+": "+m.Title, lc)
+	}
+}
+
+// checkLatest checks a latest chapter shown on a card. Quick-search
+// suggestions only carry the kind and number.
+func checkLatest(t *testing.T, where string, lc LatestChapter) {
+	t.Helper()
+	if _, err := strconv.ParseFloat(lc.Number, 64); err != nil || lc.Kind != "chapter" && lc.Kind != "volume" {
+		t.Errorf("%s: bad latest %+v", where, lc)
+	}
+	if lc.Url != "" && (!readURLRe.MatchString(lc.Url) || lc.Language == "" ||
+		!strings.HasSuffix(lc.Url, "/"+string(lc.Language)+"/"+lc.Kind+"-"+lc.Number)) {
+		t.Errorf("%s: bad latest %+v", where, lc)
+	}
+}
+
+// checkChapter checks a chapter parsed from a corpus list.
+func checkChapter(t *testing.T, where string, ch Chapter) {
+	t.Helper()
+	if ch.ID == "" || ch.Title == "" || ch.Date.IsZero() || !readURLRe.MatchString(ch.Url) ||
+		!strings.HasSuffix(ch.Url, "/"+ch.Kind+"-"+FormatNumber(ch.Number)) {
+		t.Errorf("%s: bad chapter %+v", where, ch)
+	}
+}
+
+// TestRefreshFixtures checks HandWrittenFixtures lists the whole corpus in
+// testdata and RefreshFixtures only writes files of it.
+func TestRefreshFixtures(t *testing.T) {
+	read := readFixture(t, "read_chapters_en.json")
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := "<html></html>"
+		if strings.HasPrefix(req.URL.Path, "/ajax/read/dkw/") {
+			body = read
+		}
+		return &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})
+	written, err := RefreshFixtures(context.Background(), NewClient(WithTransport(rt)), t.TempDir(), DefaultFixtureOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpus := make(map[string]bool)
+	var want []string
+	for _, e := range entries {
+		corpus[e.Name()] = true
+		want = append(want, e.Name())
+	}
+	got := append([]string(nil), HandWrittenFixtures...)
+	sort.Strings(got)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("HandWrittenFixtures = %v, want the whole corpus %v", got, want)
+	}
+	if len(written) != len(want)-2 {
+		t.Errorf("refreshed %d files, want all but genre.html and home_redesign.html", len(written))
+	}
+	for _, path := range written {
+		if !corpus[filepath.Base(path)] {
+			t.Errorf("refreshed %s, which isn't in the corpus", filepath.Base(path))
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package mfire
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chromedp/cdproto/emulation"
+)
+
+// HeaderProfile describes the request headers a particular browser sends, so
+// every request made by a Client presents one consistent fingerprint.
+type HeaderProfile struct {
+	Name            string
+	UserAgent       string
+	Accept          string
+	AcceptLanguage  string
+	SecChUa         string // empty for browsers without client hints
+	SecChUaMobile   string
+	SecChUaPlatform string
+	// HeaderOrder lists header names in the order the browser sends them.
+	// Headers it doesn't name follow in Go's order.
+	HeaderOrder []string
+}
+
+// chromeOrder and firefoxOrder are the header orders of a top-level
+// navigation in each browser.
+var (
+	chromeOrder = []string{"Host", "Connection", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+		"Upgrade-Insecure-Requests", "User-Agent", "Accept", "Sec-Fetch-Site",
+		"Sec-Fetch-Mode", "Sec-Fetch-User", "Sec-Fetch-Dest", "Referer",
+		"Accept-Encoding", "Accept-Language", "Cookie"}
+	firefoxOrder = []string{"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding",
+		"Referer", "Connection", "Cookie", "Upgrade-Insecure-Requests",
+		"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User"}
+)
+
+const chromeAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+
+// builtinProfiles are the named profiles available via LookupProfile.
+var builtinProfiles = map[string]HeaderProfile{
+	"chrome-windows": {
+		Name:            "chrome-windows",
+		UserAgent:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+		Accept:          chromeAccept,
+		AcceptLanguage:  "en-US,en;q=0.9",
+		SecChUa:         `"Not A(Brand";v="99", "Google Chrome";v="121", "Chromium";v="121"`,
+		SecChUaMobile:   "?0",
+		SecChUaPlatform: `"Windows"`,
+		HeaderOrder:     chromeOrder,
+	},
+	"chrome-macos": {
+		Name:            "chrome-macos",
+		UserAgent:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+		Accept:          chromeAccept,
+		AcceptLanguage:  "en-US,en;q=0.9",
+		SecChUa:         `"Not A(Brand";v="99", "Google Chrome";v="121", "Chromium";v="121"`,
+		SecChUaMobile:   "?0",
+		SecChUaPlatform: `"macOS"`,
+		HeaderOrder:     chromeOrder,
+	},
+	"chrome-linux": {
+		Name:            "chrome-linux",
+		UserAgent:       "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+		Accept:          chromeAccept,
+		AcceptLanguage:  "en-US,en;q=0.9",
+		SecChUa:         `"Not A(Brand";v="99", "Google Chrome";v="121", "Chromium";v="121"`,
+		SecChUaMobile:   "?0",
+		SecChUaPlatform: `"Linux"`,
+		HeaderOrder:     chromeOrder,
+	},
+	"firefox-windows": {
+		Name:           "firefox-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:122.0) Gecko/20100101 Firefox/122.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.5",
+		HeaderOrder:    firefoxOrder,
+	},
+}
+
+// DefaultProfile is the profile used when no other is configured.
+var DefaultProfile = builtinProfiles["chrome-windows"]
+
+// LookupProfile returns the built-in profile with the given name.
+func LookupProfile(name string) (HeaderProfile, bool) {
+	p, ok := builtinProfiles[name]
+	return p, ok
+}
+
+// ProfileNames returns the names of the built-in profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(builtinProfiles))
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply sets the profile's headers on h, leaving unrelated headers alone.
+func (p HeaderProfile) Apply(h http.Header) {
+	h.Set("User-Agent", p.UserAgent)
+	h.Set("Accept", p.Accept)
+	h.Set("Accept-Language", p.AcceptLanguage)
+	h.Set("Upgrade-Insecure-Requests", "1")
+	if p.SecChUa != "" {
+		h.Set("sec-ch-ua", p.SecChUa)
+		h.Set("sec-ch-ua-mobile", p.SecChUaMobile)
+		h.Set("sec-ch-ua-platform", p.SecChUaPlatform)
+	}
+}
+
+// WithHeaderProfile makes the Client send p's headers on every request.
+func WithHeaderProfile(p HeaderProfile) Option {
+	return func(c *Client) {
+		c.profiles = []HeaderProfile{p}
+	}
+}
+
+// WithProfileRotation rotates across the given profiles round-robin, one
+// profile per request.
+func WithProfileRotation(ps ...HeaderProfile) Option {
+	return func(c *Client) {
+		if len(ps) > 0 {
+			c.profiles = append([]HeaderProfile(nil), ps...)
+		}
+	}
+}
+
+// WithBrowserProfileSync replaces the Client's header profile with the one
+// reported by the headless browser the first time the VRF fallback runs, so
+// HTTP requests and the browser session look like the same client. Later
+// browser sessions are launched with the synced user agent.
+func WithBrowserProfileSync() Option {
+	return func(c *Client) {
+		c.syncProfile = true
+	}
+}
+
+// Profile returns the header profile the next request will use.
+func (c *Client) Profile() HeaderProfile {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+	if len(c.profiles) == 0 {
+		return DefaultProfile
+	}
+	return c.profiles[c.profileIdx%len(c.profiles)]
+}
+
+// nextProfile returns the profile for a new request and advances rotation.
+func (c *Client) nextProfile() HeaderProfile {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+	if len(c.profiles) == 0 {
+		return DefaultProfile
+	}
+	p := c.profiles[c.profileIdx%len(c.profiles)]
+	c.profileIdx++
+	return p
+}
+
+// newRequest builds a GET request carrying the current header profile.
+func (c *Client) newRequest(ctx context.Context, rawurl, referer string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	p := c.nextProfile()
+	p.Apply(req.Header)
+	if len(p.HeaderOrder) > 0 {
+		req = req.WithContext(withHeaderOrder(ctx, p.HeaderOrder))
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	return req, nil
+}
+
+// browserInfo is what the headless browser reports about itself.
+type browserInfo struct {
+	UserAgent string `json:"ua"`
+	Brands    []struct {
+		Brand   string `json:"brand"`
+		Version string `json:"version"`
+	} `json:"brands"`
+	Platform string `json:"platform"`
+	Mobile   bool   `json:"mobile"`
+}
+
+// browserInfoJS collects browserInfo from navigator.
+const browserInfoJS = `(function(){
+	const d = navigator.userAgentData;
+	return {
+		ua: navigator.userAgent,
+		brands: d ? d.brands : [],
+		platform: d ? d.platform : "",
+		mobile: d ? d.mobile : false,
+	};
+})()`
+
+// profileFromBrowser builds a header profile matching what the browser
+// reported, with the headless markers removed.
+func profileFromBrowser(info browserInfo) HeaderProfile {
+	p := DefaultProfile
+	p.Name = "browser"
+	p.UserAgent = strings.ReplaceAll(info.UserAgent, "HeadlessChrome", "Chrome")
+	if len(info.Brands) > 0 {
+		parts := make([]string, 0, len(info.Brands))
+		for _, b := range info.Brands {
+			brand := strings.ReplaceAll(b.Brand, "HeadlessChrome", "Google Chrome")
+			parts = append(parts, fmt.Sprintf("%q;v=%q", brand, b.Version))
+		}
+		p.SecChUa = strings.Join(parts, ", ")
+	}
+	if info.Platform != "" {
+		p.SecChUaPlatform = fmt.Sprintf("%q", info.Platform)
+	}
+	p.SecChUaMobile = "?0"
+	if info.Mobile {
+		p.SecChUaMobile = "?1"
+	}
+	return p
+}
+
+// secChUaBrandRe matches one brand of a sec-ch-ua header.
+var secChUaBrandRe = regexp.MustCompile(`"([^"]*)"\s*;\s*v="([^"]*)"`)
+
+// userAgentMetadata returns the client hints the headless browser should
+// report so they match the profile's sec-ch-ua headers, or nil for
+// browsers without client hints, which makes Chrome send none.
+func (p HeaderProfile) userAgentMetadata() *emulation.UserAgentMetadata {
+	if p.SecChUa == "" {
+		return nil
+	}
+	md := &emulation.UserAgentMetadata{
+		Platform: strings.Trim(p.SecChUaPlatform, `"`),
+		Mobile:   p.SecChUaMobile == "?1",
+	}
+	for _, m := range secChUaBrandRe.FindAllStringSubmatch(p.SecChUa, -1) {
+		md.Brands = append(md.Brands, &emulation.UserAgentBrandVersion{Brand: m[1], Version: m[2]})
+	}
+	return md
+}
+
+// browserProfile returns the profile the headless browser should present,
+// or nil to let it report its own fingerprint so the profile can be synced
+// from it.
+func (c *Client) browserProfile() *HeaderProfile {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+	if c.syncProfile && !c.synced {
+		return nil
+	}
+	p := DefaultProfile
+	if len(c.profiles) > 0 {
+		p = c.profiles[c.profileIdx%len(c.profiles)]
+	}
+	return &p
+}
+
+// syncFromBrowser adopts the browser's fingerprint when sync is enabled.
+func (c *Client) syncFromBrowser(info browserInfo) {
+	if info.UserAgent == "" {
+		return
+	}
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+	if !c.syncProfile || c.synced {
+		return
+	}
+	c.profiles = []HeaderProfile{profileFromBrowser(info)}
+	c.profileIdx = 0
+	c.synced = true
+}
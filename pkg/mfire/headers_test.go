@@ -0,0 +1,96 @@
+package mfire
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProfileSelection(t *testing.T) {
+	chrome, _ := LookupProfile("chrome-linux")
+	firefox, _ := LookupProfile("firefox-windows")
+	if _, ok := LookupProfile("netscape"); ok {
+		t.Error("unknown profile found")
+	}
+	if names := strings.Join(ProfileNames(), " "); names != "chrome-linux chrome-macos chrome-windows firefox-windows" {
+		t.Errorf("ProfileNames = %s", names)
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []string // profile of each request, in order
+	}{
+		{"default", nil, []string{"chrome-windows", "chrome-windows"}},
+		{"fixed", []Option{WithHeaderProfile(firefox)}, []string{"firefox-windows", "firefox-windows"}},
+		{"rotation", []Option{WithProfileRotation(chrome, firefox)}, []string{"chrome-linux", "firefox-windows", "chrome-linux"}},
+		{"empty rotation", []Option{WithHeaderProfile(chrome), WithProfileRotation()}, []string{"chrome-linux"}},
+	}
+	for _, tt := range tests {
+		c := NewClient(tt.opts...)
+		for i, want := range tt.want {
+			p, _ := LookupProfile(want)
+			if got := c.Profile().Name; got != want {
+				t.Errorf("%s: Profile() before request %d = %s, want %s", tt.name, i, got, want)
+			}
+			req, err := c.newRequest(context.Background(), "https://mangafire.to/home", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := req.Header
+			if h.Get("User-Agent") != p.UserAgent || h.Get("Accept-Language") != p.AcceptLanguage ||
+				h.Get("sec-ch-ua") != p.SecChUa || h.Get("sec-ch-ua-platform") != p.SecChUaPlatform {
+				t.Errorf("%s: request %d sent %v, want the %s profile", tt.name, i, h, want)
+			}
+		}
+	}
+	if h := (NewClient(WithHeaderProfile(firefox))).Profile(); h.SecChUa != "" {
+		t.Errorf("firefox sends client hints: %q", h.SecChUa)
+	}
+}
+
+func TestBrowserProfile(t *testing.T) {
+	chrome, _ := LookupProfile("chrome-macos")
+	c := NewClient(WithHeaderProfile(chrome))
+	p := c.browserProfile()
+	if p == nil || p.UserAgent != chrome.UserAgent {
+		t.Fatalf("browser launched as %+v, want the chrome-macos profile", p)
+	}
+	md := p.userAgentMetadata()
+	if md == nil || md.Platform != "macOS" || md.Mobile || len(md.Brands) != 3 ||
+		md.Brands[1].Brand != "Google Chrome" || md.Brands[1].Version != "121" {
+		t.Errorf("client hints = %+v", md)
+	}
+	firefox, _ := LookupProfile("firefox-windows")
+	if md := firefox.userAgentMetadata(); md != nil {
+		t.Errorf("firefox client hints = %+v, want none", md)
+	}
+
+	// with sync, the browser reports its own fingerprint once, which then
+	// replaces the profile for HTTP requests and later browsers
+	c = NewClient(WithHeaderProfile(chrome), WithBrowserProfileSync())
+	if p := c.browserProfile(); p != nil {
+		t.Fatalf("browser launched as %+v before syncing", p)
+	}
+	info := browserInfo{
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/126.0.0.0 Safari/537.36",
+		Platform:  "Linux",
+	}
+	info.Brands = append(info.Brands, struct {
+		Brand   string `json:"brand"`
+		Version string `json:"version"`
+	}{"HeadlessChrome", "126"})
+	c.syncFromBrowser(info)
+	p = c.browserProfile()
+	if p == nil || p.Name != "browser" || strings.Contains(p.UserAgent, "Headless") ||
+		p.SecChUa != `"Google Chrome";v="126"` || p.SecChUaPlatform != `"Linux"` {
+		t.Fatalf("synced profile = %+v", p)
+	}
+	if md := p.userAgentMetadata(); md.Platform != "Linux" || md.Brands[0].Version != "126" {
+		t.Errorf("synced client hints = %+v", md)
+	}
+	c.syncFromBrowser(browserInfo{UserAgent: "Other/1.0"})
+	if c.Profile().UserAgent != p.UserAgent {
+		t.Error("profile synced twice")
+	}
+}
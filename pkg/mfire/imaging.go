@@ -0,0 +1,115 @@
+package mfire
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// DeviceProfile describes a reading device: the screen size pages are
+// scaled down to and whether it shows colour.
+type DeviceProfile struct {
+	Name        string
+	Width       int // screen width in pixels, portrait
+	Height      int // screen height in pixels, portrait
+	Grayscale   bool
+	JPEGQuality int // quality of re-encoded pages; 0 means 85
+}
+
+// Built-in device profiles.
+var deviceProfiles = []DeviceProfile{
+	{Name: "kindle-paperwhite", Width: 1236, Height: 1648, Grayscale: true},
+	{Name: "kindle-oasis", Width: 1264, Height: 1680, Grayscale: true},
+	{Name: "kindle-scribe", Width: 1860, Height: 2480, Grayscale: true},
+	{Name: "kobo-clara", Width: 1072, Height: 1448, Grayscale: true},
+	{Name: "kobo-libra", Width: 1264, Height: 1680, Grayscale: true},
+	{Name: "remarkable", Width: 1404, Height: 1872, Grayscale: true},
+	{Name: "tablet", Width: 1640, Height: 2360, JPEGQuality: 90},
+}
+
+// LookupDevice returns the built-in device profile with the given name.
+func LookupDevice(name string) (DeviceProfile, bool) {
+	for _, d := range deviceProfiles {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return DeviceProfile{}, false
+}
+
+// DeviceNames lists the built-in device profiles.
+func DeviceNames() []string {
+	names := make([]string, len(deviceProfiles))
+	for i, d := range deviceProfiles {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// quality returns the JPEG quality for pages re-encoded for the device.
+func (d DeviceProfile) quality() int {
+	if d.JPEGQuality <= 0 || d.JPEGQuality > 100 {
+		return 85
+	}
+	return d.JPEGQuality
+}
+
+// Apply scales img down to fit the device's screen, keeping its aspect
+// ratio, and converts it to grayscale for e-ink devices. Images already
+// small enough aren't scaled up.
+func (d DeviceProfile) Apply(img image.Image) image.Image {
+	img = fitImage(img, d.Width, d.Height)
+	if d.Grayscale {
+		img = grayscale(img)
+	}
+	return img
+}
+
+// fitImage scales img down to fit within maxW x maxH; zero means no limit
+// on that side.
+func fitImage(img image.Image, maxW, maxH int) image.Image {
+	b := img.Bounds()
+	w, h := fitSize(b.Dx(), b.Dy(), maxW, maxH)
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// fitSize returns w x h scaled down to fit within maxW x maxH.
+func fitSize(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		if s := float64(maxH) / float64(h); s < scale {
+			scale = s
+		}
+	}
+	if scale == 1 {
+		return w, h
+	}
+	nw, nh := int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	return nw, nh
+}
+
+// grayscale converts img to 8-bit gray.
+func grayscale(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	b := img.Bounds()
+	g := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(g, g.Bounds(), img, b.Min, draw.Src)
+	return g
+}
@@ -0,0 +1,116 @@
+package mfire
+
+import "strings"
+
+// Language is a site language code as used in reader URLs and ajax
+// endpoints, always lower case: "en", "ja", "es-la", "pt-br".
+type Language string
+
+// Languages the site currently offers. Others may appear; ParseLanguage
+// accepts any code.
+const (
+	English          Language = "en"
+	Japanese         Language = "ja"
+	French           Language = "fr"
+	Spanish          Language = "es"
+	SpanishLatAm     Language = "es-la"
+	Portuguese       Language = "pt"
+	PortugueseBrazil Language = "pt-br"
+)
+
+// DefaultLanguage is preferred when a Client has no WithLanguages option.
+const DefaultLanguage = English
+
+// ParseLanguage normalises a language code as found on the site or typed by
+// a user: "ES-LA", "es_la" and " es-la " all become SpanishLatAm.
+func ParseLanguage(s string) Language {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return Language(strings.ReplaceAll(s, "_", "-"))
+}
+
+// ParseLanguages parses a comma-separated preference list such as
+// "es,es-la,en", skipping empty entries.
+func ParseLanguages(s string) []Language {
+	var out []Language
+	for _, f := range strings.Split(s, ",") {
+		if l := ParseLanguage(f); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Family returns the language without its region: "es" for "es-la".
+func (l Language) Family() Language {
+	base, _, _ := strings.Cut(string(l), "-")
+	return Language(base)
+}
+
+func (l Language) String() string { return string(l) }
+
+// ISO returns the BCP 47 tag for l as expected by metadata formats such as
+// ComicInfo and EPUB: "es-419" for Latin American Spanish, "pt-BR" for
+// Brazilian Portuguese.
+func (l Language) ISO() string {
+	switch l {
+	case SpanishLatAm:
+		return "es-419"
+	case "":
+		return ""
+	}
+	base, region, ok := strings.Cut(string(l), "-")
+	if !ok {
+		return base
+	}
+	return base + "-" + strings.ToUpper(region)
+}
+
+// WithLanguages sets the Client's preferred chapter languages, most
+// preferred first. Without it only English is preferred. See
+// Client.ChapterList for how the preferences are applied.
+func WithLanguages(langs ...Language) Option {
+	return func(c *Client) {
+		c.languages = nil
+		for _, l := range langs {
+			if l = ParseLanguage(string(l)); l != "" {
+				c.languages = append(c.languages, l)
+			}
+		}
+	}
+}
+
+// Languages returns the Client's preferred chapter languages.
+func (c *Client) Languages() []Language {
+	if len(c.languages) == 0 {
+		return []Language{DefaultLanguage}
+	}
+	return append([]Language(nil), c.languages...)
+}
+
+// rankLanguages orders the available languages by preference and drops the
+// ones not wanted. Each preference contributes its exact match and then its
+// regional variants, so a preference for "es" also accepts "es-la" (and
+// "pt-br" accepts "pt") before moving on to the next preference.
+func rankLanguages(available, preferred []Language) []Language {
+	var out []Language
+	seen := make(map[Language]bool)
+	add := func(l Language) {
+		if !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	for _, p := range preferred {
+		for _, a := range available {
+			if a == p {
+				add(a)
+			}
+		}
+		for _, a := range available {
+			if a.Family() == p.Family() {
+				add(a)
+			}
+		}
+	}
+	return out
+}
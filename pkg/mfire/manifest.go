@@ -0,0 +1,171 @@
+package mfire
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest the Downloader keeps in every
+// chapter directory.
+const ManifestFile = "mfire-manifest.json"
+
+// ErrNoManifest is returned by Resume for a directory without a manifest.
+var ErrNoManifest = errors.New("mfire: no download manifest")
+
+// Manifest records the state of a chapter download so an interrupted one
+// can be resumed: which pages were written, and their size and checksum.
+type Manifest struct {
+	Chapter  Chapter        `json:"chapter"`
+	Pages    []ManifestPage `json:"pages"`
+	Complete bool           `json:"complete"`
+	Updated  time.Time      `json:"updated"`
+
+	mu sync.Mutex
+}
+
+// ManifestPage is the state of one page.
+type ManifestPage struct {
+	Url    string `json:"url"`
+	Offset int    `json:"offset,omitempty"`
+	File   string `json:"file,omitempty"` // name within the chapter directory
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Done   bool   `json:"done"`
+}
+
+// LoadManifest reads the manifest in dir.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w in %s", ErrNoManifest, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("load manifest %s: %w", dir, err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to dir atomically.
+func (m *Manifest) Save(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveLocked(dir)
+}
+
+func (m *Manifest) saveLocked(dir string) error {
+	m.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, ManifestFile), append(data, '\n'), 0o644)
+}
+
+// Pending returns the number of pages not downloaded yet.
+func (m *Manifest) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, p := range m.Pages {
+		if !p.Done {
+			n++
+		}
+	}
+	return n
+}
+
+// openManifest returns the manifest for downloading pages of ch into dir.
+// A manifest left by an earlier run for the same chapter keeps the state
+// of pages whose URL hasn't changed; anything else starts afresh.
+func openManifest(dir string, ch Chapter, pages []Page) *Manifest {
+	m := &Manifest{Chapter: ch, Pages: make([]ManifestPage, len(pages))}
+	for i, p := range pages {
+		m.Pages[i] = ManifestPage{Url: p.Url, Offset: p.Offset}
+	}
+	old, err := LoadManifest(dir)
+	if err != nil || old.Chapter.ID != ch.ID {
+		return m
+	}
+	for i := range m.Pages {
+		if i < len(old.Pages) && old.Pages[i].Url == m.Pages[i].Url {
+			m.Pages[i] = old.Pages[i]
+		}
+	}
+	return m
+}
+
+// verified reports whether page i was downloaded and its file is still
+// intact, i.e. has the recorded size and checksum.
+func (m *Manifest) verified(dir string, i int) bool {
+	m.mu.Lock()
+	p := m.Pages[i]
+	m.mu.Unlock()
+	if !p.Done || p.File == "" {
+		return false
+	}
+	f, err := os.Open(filepath.Join(dir, p.File))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || fi.Size() != p.Size {
+		return false
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == p.SHA256
+}
+
+// finish records page i as written to file with the given contents and
+// saves the manifest.
+func (m *Manifest) finish(dir string, i int, file string, data []byte) error {
+	sum := sha256.Sum256(data)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := &m.Pages[i]
+	p.File, p.Size, p.SHA256, p.Done = filepath.Base(file), int64(len(data)), hex.EncodeToString(sum[:]), true
+	return m.saveLocked(dir)
+}
+
+// invalidate marks page i as not downloaded.
+func (m *Manifest) invalidate(i int) {
+	m.mu.Lock()
+	m.Pages[i].Done = false
+	m.mu.Unlock()
+}
+
+// Resume continues the download recorded in dir's manifest: pages whose
+// files are intact are kept, missing or damaged ones are fetched again.
+// When the recorded page URLs no longer work the page list is fetched
+// anew. It returns the files in page order.
+func (d *Downloader) Resume(ctx context.Context, dir string) ([]string, error) {
+	m, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]Page, len(m.Pages))
+	for i, p := range m.Pages {
+		pages[i] = Page{Url: p.Url, Offset: p.Offset}
+	}
+	files, err := d.DownloadPages(ctx, m.Chapter, pages, dir)
+	var se *StatusError
+	if errors.As(err, &se) && (se.Code == 403 || se.Code == 404 || se.Code == 410) {
+		return d.Download(ctx, m.Chapter, dir)
+	}
+	return files, err
+}
@@ -0,0 +1,119 @@
+package mfire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDownloaderResume(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, gradient(30, 40)); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu   sync.Mutex
+		hits = make(map[string]int)
+		down = map[string]bool{"/3.png": true}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+		if down[r.URL.Path] {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(img.Bytes())
+	}))
+	defer srv.Close()
+
+	ch := Chapter{ID: "42", Number: 7}
+	var pages []Page
+	for _, p := range []string{"/1.png", "/2.png", "/3.png", "/4.png"} {
+		pages = append(pages, Page{Url: srv.URL + p})
+	}
+	dir := t.TempDir()
+	d := NewDownloader(NewClient())
+	d.Retries = -1
+	if _, err := d.DownloadPages(context.Background(), ch, pages, dir); err == nil {
+		t.Fatal("first run succeeded, want page 3 to fail")
+	}
+	m, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Complete || m.Pending() != 1 || m.Chapter.ID != "42" {
+		t.Fatalf("manifest after first run: complete=%v pending=%d chapter=%q", m.Complete, m.Pending(), m.Chapter.ID)
+	}
+
+	// page 1 is truncated, page 2 modified in place and page 4 deleted
+	truncate := filepath.Join(dir, "001.png")
+	if err := os.WriteFile(truncate, img.Bytes()[:img.Len()/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modified := append([]byte(nil), img.Bytes()...)
+	modified[len(modified)-20] ^= 0xff
+	if err := os.WriteFile(filepath.Join(dir, "002.png"), modified, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "004.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	hits = make(map[string]int)
+	delete(down, "/3.png")
+	mu.Unlock()
+	var skipped int
+	d.Progress = func(p Progress) {
+		if p.Skipped {
+			skipped++
+		}
+	}
+	files, err := d.Resume(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 || skipped != 0 {
+		t.Errorf("resume: %d files, %d skipped", len(files), skipped)
+	}
+	for _, p := range []string{"/1.png", "/2.png", "/3.png", "/4.png"} {
+		if hits[p] != 1 {
+			t.Errorf("%s fetched %d times, want 1", p, hits[p])
+		}
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, img.Bytes()) {
+			t.Errorf("%s differs from the served image", f)
+		}
+	}
+
+	// a finished download is verified, not fetched again
+	hits = make(map[string]int)
+	skipped = 0
+	if _, err := d.Resume(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 0 || skipped != 4 {
+		t.Errorf("complete resume: %d fetches, %d skipped", len(hits), skipped)
+	}
+	if m, err := LoadManifest(dir); err != nil || !m.Complete {
+		t.Errorf("manifest complete = %v, %v", m != nil && m.Complete, err)
+	}
+
+	if _, err := d.Resume(context.Background(), t.TempDir()); !errors.Is(err, ErrNoManifest) {
+		t.Errorf("resume without manifest: %v, want ErrNoManifest", err)
+	}
+}
@@ -1,8 +1,106 @@
 package mfire
 
-// Manga is a minimal model returned by the parser.
+import (
+	"strings"
+	"time"
+)
+
+// Manga is a listing entry as shown on the home, filter and category pages.
+// Fields the page doesn't show are left empty.
 type Manga struct {
-	Title string
-	Url   string
-	Cover string
+	ID     string  `json:"id"`   // stable site ID, e.g. "dkw"
+	Slug   string  `json:"slug"` // URL slug, e.g. "one-piecee"
+	Title  string  `json:"title"`
+	Url    string  `json:"url"`
+	Cover  string  `json:"cover"`
+	Type   string  `json:"type,omitempty"`   // e.g. "Manga", "Manhwa"
+	Status string  `json:"status,omitempty"` // e.g. "Releasing"
+	Rating float64 `json:"rating,omitempty"`
+	// Latest holds the newest chapters and volumes shown on the card, one
+	// per language where the site lists several; DedupePolicy.DedupeLatest
+	// keeps one per number.
+	Latest []LatestChapter `json:"latest,omitempty"`
+}
+
+// LatestChapter is a chapter or volume link shown on a listing card.
+type LatestChapter struct {
+	Kind     string    `json:"kind"`   // "chapter" or "volume"
+	Number   string    `json:"number"` // as shown, e.g. "1100" or "179.5"
+	Language Language  `json:"language"`
+	Date     time.Time `json:"date"` // zero when the card shows none
+	Url      string    `json:"url"`
+}
+
+// HomeSections holds the discovery lists shown on the home page.
+type HomeSections struct {
+	Trending        []Manga    `json:"trending"`
+	MostViewed      MostViewed `json:"mostViewed"`
+	RecentlyUpdated []Manga    `json:"recentlyUpdated"` // each with Latest filled in
+	NewReleases     []Manga    `json:"newReleases"`
+}
+
+// MostViewed holds the most-viewed rankings, one list per tab.
+type MostViewed struct {
+	Day   []Manga `json:"day"`
+	Week  []Manga `json:"week"`
+	Month []Manga `json:"month"`
+}
+
+// Details is the information on a manga's detail page.
+type Details struct {
+	MangaRef
+	Title       string          `json:"title"`
+	AltTitles   []string        `json:"altTitles,omitempty"`
+	Url         string          `json:"url"`
+	Cover       string          `json:"cover"`
+	Type        string          `json:"type,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Rating      float64         `json:"rating,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Authors     []string        `json:"authors,omitempty"`
+	Genres      []string        `json:"genres,omitempty"`
+	Magazines   []string        `json:"magazines,omitempty"`
+	Published   string          `json:"published,omitempty"` // as shown, e.g. "Jul 22, 1997 to ?"
+	Languages   []MangaLanguage `json:"languages,omitempty"`
 }
+
+// RightToLeft reports whether the manga reads right to left, which is the
+// case for Japanese manga. It is false for nil details.
+func (d *Details) RightToLeft() bool {
+	return d != nil && strings.EqualFold(d.Type, "manga")
+}
+
+// MangaLanguage is a language a manga's chapters are available in, as
+// listed in the language dropdown of its detail page.
+type MangaLanguage struct {
+	Language Language `json:"language"`
+	Name     string   `json:"name"`     // e.g. "Spanish (LATAM)"
+	Chapters int      `json:"chapters"` // 0 when the page doesn't say
+}
+
+// Chapter is one chapter of a manga in one language. Volumes the site
+// offers as a whole are Chapters too, with Kind "volume" and their volume
+// number as both Number and Volume.
+type Chapter struct {
+	ID       string    `json:"id"` // reader chapter ID, used to fetch pages
+	Manga    MangaRef  `json:"manga"`
+	Kind     string    `json:"kind,omitempty"` // "chapter" or "volume"
+	Number   float64   `json:"number"`
+	Volume   float64   `json:"volume,omitempty"` // 0 when unknown
+	Title    string    `json:"title"`            // e.g. "Chapter 1100: Luffy's Dream"
+	Language Language  `json:"language"`
+	Date     time.Time `json:"date"` // zero when the site shows none
+	Url      string    `json:"url"`
+	// PageCount is 0 until counted, see Client.CountPages.
+	PageCount int `json:"pageCount,omitempty"`
+}
+
+// Page is one image of a chapter. Offset is the site's scrambling key; a
+// positive offset means the image is served with its tiles shuffled.
+type Page struct {
+	Url    string `json:"url"`
+	Offset int    `json:"offset"`
+}
+
+// Scrambled reports whether the image has to be descrambled before use.
+func (p Page) Scrambled() bool { return p.Offset > 0 }
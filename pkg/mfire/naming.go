@@ -0,0 +1,411 @@
+package mfire
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultNameTemplate lays downloads out as <manga>/chapter-<n>, or
+// volume-<n> for volumes, with the format's extension for archives and
+// books.
+const DefaultNameTemplate = "{slug}/{kind}-{chapter}{ext}"
+
+// ErrBadTemplate is returned for a naming template that doesn't parse.
+var ErrBadTemplate = errors.New("mfire: bad name template")
+
+// NameTemplate turns chapters into file paths. Templates are text with
+// fields in braces; "/" separates directories:
+//
+//	{series}/{volume:02}/{series} - c{chapter:03.1f} [{lang}].cbz
+//
+// The fields are:
+//
+//	series   the manga's title (its slug when the details are unknown)
+//	slug     the manga's URL slug
+//	id       the manga's site ID
+//	author   the manga's first author
+//	type     the manga's type, e.g. "Manga"
+//	kind     "chapter", or "volume" for a volume downloaded as a whole
+//	chapter  the chapter number; the volume number for a volume
+//	volume   the volume number, empty when unknown
+//	title    the chapter's title
+//	lang     the chapter's language code
+//	date     the chapter's release date as 2006-01-02, empty when unknown
+//	year     the chapter's release year, empty when unknown
+//	ext      the format's extension (".cbz"), empty for images
+//
+// Numbers take a printf-style spec after a colon: {chapter:05.1f} gives
+// "010.5" and "003.0". Without f or g the integer part is padded and any
+// fraction kept as is: {chapter:03} gives "010.5" and "003". Text fields
+// take a maximum length in characters: {title:40}. Write "{{" and "}}" for
+// literal braces.
+//
+// Field values can't add directories: separators and characters that are
+// invalid on Windows, macOS or Linux are replaced, and every path segment
+// is trimmed of trailing dots and spaces, kept clear of reserved names such
+// as CON or NUL, and cut to 200 bytes. Empty segments are dropped.
+type NameTemplate struct {
+	raw   string
+	parts []namePart
+}
+
+type namePart struct {
+	literal string
+	field   string
+	spec    string
+}
+
+var (
+	nameFields = map[string]bool{
+		"series": false, "slug": false, "id": false, "author": false, "type": false,
+		"kind": false, "chapter": true, "volume": true, "title": false, "lang": false,
+		"date": false, "year": false, "ext": false,
+	}
+	numberSpecRe = regexp.MustCompile(`^0?\d*(\.\d+)?[dfg]?$`)
+	textSpecRe   = regexp.MustCompile(`^\d+$`)
+)
+
+// ParseNameTemplate parses a naming template.
+func ParseNameTemplate(s string) (*NameTemplate, error) {
+	t := &NameTemplate{raw: s}
+	var lit strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '{' && strings.HasPrefix(s[i:], "{{"), c == '}' && strings.HasPrefix(s[i:], "}}"):
+			lit.WriteByte(c)
+			i++
+		case c == '}':
+			return nil, fmt.Errorf("%w: unmatched } at %d in %q", ErrBadTemplate, i, s)
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed { at %d in %q", ErrBadTemplate, i, s)
+			}
+			name, spec, _ := strings.Cut(s[i+1:i+end], ":")
+			numeric, ok := nameFields[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown field {%s} in %q", ErrBadTemplate, name, s)
+			}
+			if spec != "" && (numeric && !numberSpecRe.MatchString(spec) || !numeric && !textSpecRe.MatchString(spec)) {
+				return nil, fmt.Errorf("%w: bad spec %q for {%s}", ErrBadTemplate, spec, name)
+			}
+			if lit.Len() > 0 {
+				t.parts = append(t.parts, namePart{literal: lit.String()})
+				lit.Reset()
+			}
+			t.parts = append(t.parts, namePart{field: name, spec: spec})
+			i += end
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	if lit.Len() > 0 {
+		t.parts = append(t.parts, namePart{literal: lit.String()})
+	}
+	return t, nil
+}
+
+// String returns the template as parsed.
+func (t *NameTemplate) String() string { return t.raw }
+
+// NeedsDetails reports whether the template uses fields taken from the
+// manga's details, so callers know to fetch them.
+func (t *NameTemplate) NeedsDetails() bool {
+	for _, p := range t.parts {
+		switch p.field {
+		case "series", "author", "type":
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the path of ch saved in format ("images", "cbz", "epub" or
+// "pdf"), relative and with the OS's separators. details may be nil. The
+// format's extension is appended when the template doesn't end with it.
+func (t *NameTemplate) Name(details *Details, ch Chapter, format string) string {
+	ext := ""
+	if format != "" && format != "images" {
+		ext = "." + format
+	}
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		b.WriteString(sanitizeName(nameValue(p, details, ch, ext), false))
+	}
+	var segs []string
+	for _, seg := range strings.Split(b.String(), "/") {
+		if seg = sanitizeName(seg, true); seg != "" {
+			segs = append(segs, seg)
+		}
+	}
+	if len(segs) == 0 {
+		segs = []string{"chapter-" + FormatNumber(ch.Number)}
+	}
+	last := &segs[len(segs)-1]
+	if ext != "" && !strings.HasSuffix(strings.ToLower(*last), ext) {
+		*last = truncateName(*last+ext, ext)
+	}
+	return filepath.Join(segs...)
+}
+
+// nameValue is the unsanitised value of a field.
+func nameValue(p namePart, details *Details, ch Chapter, ext string) string {
+	var s string
+	switch p.field {
+	case "chapter":
+		return formatNameNumber(ch.Number, p.spec)
+	case "volume":
+		if ch.Volume == 0 {
+			return ""
+		}
+		return formatNameNumber(ch.Volume, p.spec)
+	case "series":
+		s = ch.Manga.Slug
+		if details != nil && details.Title != "" {
+			s = details.Title
+		}
+	case "slug":
+		s = ch.Manga.Slug
+	case "id":
+		s = ch.Manga.ID
+	case "author":
+		if details != nil && len(details.Authors) > 0 {
+			s = details.Authors[0]
+		}
+	case "type":
+		if details != nil {
+			s = details.Type
+		}
+	case "kind":
+		s = ch.Kind
+		if s == "" {
+			s = "chapter"
+		}
+	case "title":
+		s = ch.Title
+	case "lang":
+		s = string(ch.Language)
+	case "date":
+		if !ch.Date.IsZero() {
+			s = ch.Date.Format("2006-01-02")
+		}
+	case "year":
+		if !ch.Date.IsZero() {
+			s = strconv.Itoa(ch.Date.Year())
+		}
+	case "ext":
+		s = ext
+	}
+	if p.spec != "" {
+		n, _ := strconv.Atoi(p.spec)
+		if utf8.RuneCountInString(s) > n {
+			s = strings.TrimSpace(string([]rune(s)[:n]))
+		}
+	}
+	return s
+}
+
+// formatNameNumber formats n by a template spec: printf when it ends in
+// f or g, otherwise the integer part padded to the width with the fraction
+// kept as FormatNumber writes it.
+func formatNameNumber(n float64, spec string) string {
+	if spec == "" {
+		return FormatNumber(n)
+	}
+	if verb := spec[len(spec)-1]; verb == 'f' || verb == 'g' {
+		return fmt.Sprintf("%"+spec, n)
+	}
+	spec = strings.TrimSuffix(spec, "d")
+	spec, _, _ = strings.Cut(spec, ".")
+	whole, frac, _ := strings.Cut(FormatNumber(n), ".")
+	i, _ := strconv.Atoi(whole)
+	s := fmt.Sprintf("%"+spec+"d", i)
+	if frac != "" {
+		s += "." + frac
+	}
+	return s
+}
+
+// windowsReserved are device names Windows refuses as file names, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName makes s safe in a file name on every platform: characters
+// Windows forbids, separators and control characters become "_" (":"
+// becomes "-"), and runs of spaces collapse. A whole segment is also
+// trimmed of leading spaces and trailing dots and spaces, moved off
+// reserved and dot-only names, and cut to 200 bytes.
+func sanitizeName(s string, segment bool) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch {
+		case r == ':':
+			r = '-'
+		case strings.ContainsRune(`<>"/\|?*`, r), unicode.IsControl(r), r == utf8.RuneError:
+			r = '_'
+		case unicode.IsSpace(r):
+			if space {
+				continue
+			}
+			r = ' '
+		}
+		space = r == ' '
+		b.WriteRune(r)
+	}
+	s = b.String()
+	if !segment {
+		return s
+	}
+	s = strings.TrimLeft(s, " ")
+	s = strings.TrimRight(s, ". ")
+	if s == "" {
+		return ""
+	}
+	base, _, _ := strings.Cut(s, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimSpace(base))] {
+		s = "_" + s
+	}
+	return truncateName(s, filepath.Ext(s))
+}
+
+// maxNameBytes leaves room for a collision suffix and the staging
+// directory's prefix and suffix under the usual 255-byte limit.
+const maxNameBytes = 200
+
+// truncateName cuts s to maxNameBytes on a rune boundary, keeping ext.
+func truncateName(s, ext string) string {
+	if len(s) <= maxNameBytes {
+		return s
+	}
+	if len(ext) > 16 {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(s, ext)
+	cut := maxNameBytes - len(ext)
+	for cut > 0 && !utf8.RuneStart(stem[cut]) {
+		cut--
+	}
+	return strings.TrimRight(stem[:cut], ". ") + ext
+}
+
+// Collision decides what a plan does with a path that already exists.
+type Collision int
+
+const (
+	// CollisionRename picks a free name by adding " (2)", " (3)", ...
+	CollisionRename Collision = iota
+	// CollisionSkip leaves the existing file alone and skips the chapter.
+	CollisionSkip
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite
+)
+
+// ParseCollision parses "rename", "skip" or "overwrite".
+func ParseCollision(s string) (Collision, error) {
+	switch s {
+	case "rename":
+		return CollisionRename, nil
+	case "skip":
+		return CollisionSkip, nil
+	case "overwrite":
+		return CollisionOverwrite, nil
+	}
+	return 0, fmt.Errorf("unknown collision policy %q (want rename, skip or overwrite)", s)
+}
+
+// DefaultCollision is the policy for format when none is given. A CBZ,
+// EPUB or PDF file at a chapter's path is almost always that chapter's
+// earlier download, so it is skipped rather than saved again under a new
+// name. Image directories are renamed, as their manifest already tells a
+// chapter's own directory apart from someone else's.
+func DefaultCollision(format string) Collision {
+	if format == "images" || format == "" {
+		return CollisionRename
+	}
+	return CollisionSkip
+}
+
+// PlannedPath is where a chapter will be saved.
+type PlannedPath struct {
+	Chapter Chapter
+	Path    string
+	// Exists is set when something is already at Path (for CollisionSkip
+	// and CollisionOverwrite) or was at the template's path (for
+	// CollisionRename).
+	Exists bool
+	// Skip is set when the chapter shouldn't be downloaded.
+	Skip bool
+}
+
+// Plan names chapters under root for saving in format. Chapters that
+// render to the same path are told apart by a " (2)", " (3)", ... suffix;
+// paths already on disk are handled by policy. An image directory whose
+// manifest is for the same chapter is that chapter's earlier download, not
+// a collision: it is never renamed, and counts as existing once complete.
+// Plan only looks at the disk; run it again right before downloading.
+func (t *NameTemplate) Plan(root string, details *Details, chapters []Chapter, format string, policy Collision) []PlannedPath {
+	images := format == "images" || format == ""
+	taken := make(map[string]bool)
+	out := make([]PlannedPath, len(chapters))
+	for i, ch := range chapters {
+		// exists reports whether p is on disk, and whether it is ch's own
+		// image directory
+		exists := func(p string) (bool, bool) {
+			if _, err := os.Stat(p); err != nil {
+				return false, false
+			}
+			if images {
+				if m, err := LoadManifest(p); err == nil && m.Chapter.ID == ch.ID {
+					return m.Complete, true
+				}
+			}
+			return true, false
+		}
+		collides := func(p string) bool {
+			if taken[strings.ToLower(p)] {
+				return true
+			}
+			found, own := exists(p)
+			return policy == CollisionRename && found && !own
+		}
+
+		path := filepath.Join(root, t.Name(details, ch, format))
+		pp := PlannedPath{Chapter: ch, Path: path}
+		pp.Exists, _ = exists(path)
+		pp.Skip = pp.Exists && policy == CollisionSkip
+		if collides(path) {
+			ext := ""
+			if !images {
+				ext = filepath.Ext(path)
+			}
+			stem := strings.TrimSuffix(path, ext)
+			for n := 2; ; n++ {
+				if p := fmt.Sprintf("%s (%d)%s", stem, n, ext); !collides(p) {
+					path = p
+					break
+				}
+			}
+		}
+		taken[strings.ToLower(path)] = true
+		pp.Path = path
+		out[i] = pp
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package mfire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNameTemplate(t *testing.T) {
+	details := &Details{Title: "One Piece: Episode A?", Authors: []string{"ODA Eiichiro"}, Type: "Manga"}
+	ch := Chapter{
+		Manga:    MangaRef{ID: "dkw", Slug: "one-piecee"},
+		Number:   10.5,
+		Volume:   3,
+		Title:    "Chapter 10.5: Who/What <Is> It...",
+		Language: SpanishLatAm,
+		Date:     time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		template string
+		details  *Details
+		ch       Chapter
+		format   string
+		want     string
+	}{
+		{DefaultNameTemplate, details, ch, "cbz", "one-piecee/chapter-10.5.cbz"},
+		{DefaultNameTemplate, details, ch, "images", "one-piecee/chapter-10.5"},
+		{DefaultNameTemplate, details, VolumeGroup{Volume: 3, Chapters: []Chapter{ch}}.Chapter(), "cbz", "one-piecee/volume-3.cbz"},
+		{"{series}/{volume:02}/{series} - c{chapter:05.1f} [{lang}].cbz", details, ch, "cbz",
+			"One Piece- Episode A_/03/One Piece- Episode A_ - c010.5 [es-la].cbz"},
+		{"{series}/{volume:02}/c{chapter:03}", nil, Chapter{Manga: ch.Manga, Number: 7}, "pdf", "one-piecee/c007.pdf"},
+		{"{slug} {year}/{date} {title:12}", details, ch, "epub", "one-piecee 2023/2023-11-20 Chapter 10.5.epub"},
+		{"{title}", details, ch, "images", "Chapter 10.5- Who_What _Is_ It"},
+		{"{author}/{{{type}}}{ext}", details, ch, "cbz", "ODA Eiichiro/{Manga}.cbz"},
+		{"con/../{slug}..", details, ch, "cbz", "_con/one-piecee.cbz"},
+		{"  ", details, ch, "cbz", "chapter-10.5.cbz"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseNameTemplate(tt.template)
+		if err != nil {
+			t.Errorf("%q: %v", tt.template, err)
+			continue
+		}
+		if got := tmpl.Name(tt.details, tt.ch, tt.format); got != filepath.FromSlash(tt.want) {
+			t.Errorf("%q = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	long, _ := ParseNameTemplate("{title}")
+	name := long.Name(nil, Chapter{Title: strings.Repeat("長", 100)}, "cbz")
+	if len(name) > maxNameBytes || !strings.HasSuffix(name, "長.cbz") {
+		t.Errorf("long name: %d bytes, %q", len(name), name)
+	}
+
+	for _, bad := range []string{"{nope}", "{chapter", "c}", "{chapter:x}", "{title:3f}"} {
+		if _, err := ParseNameTemplate(bad); !errors.Is(err, ErrBadTemplate) {
+			t.Errorf("%q: err = %v, want ErrBadTemplate", bad, err)
+		}
+	}
+}
+
+func TestNameTemplatePlan(t *testing.T) {
+	root := t.TempDir()
+	tmpl, err := ParseNameTemplate("{slug}/vol-{volume}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manga := MangaRef{ID: "dkw", Slug: "op"}
+	chapters := []Chapter{
+		{ID: "1", Manga: manga, Number: 1, Volume: 1},
+		{ID: "2", Manga: manga, Number: 2, Volume: 1},
+		{ID: "3", Manga: manga, Number: 3, Volume: 2},
+	}
+	if err := os.MkdirAll(filepath.Join(root, "op"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "op", "vol-2.cbz"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := func(plan []PlannedPath) []string {
+		var out []string
+		for _, p := range plan {
+			rel, _ := filepath.Rel(root, p.Path)
+			if p.Skip {
+				rel += " skip"
+			}
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return out
+	}
+	tests := []struct {
+		policy Collision
+		want   string
+	}{
+		{CollisionRename, "op/vol-1.cbz op/vol-1 (2).cbz op/vol-2 (2).cbz"},
+		{CollisionSkip, "op/vol-1.cbz op/vol-1 (2).cbz op/vol-2.cbz skip"},
+		{CollisionOverwrite, "op/vol-1.cbz op/vol-1 (2).cbz op/vol-2.cbz"},
+	}
+	for _, tt := range tests {
+		plan := tmpl.Plan(root, nil, chapters, "cbz", tt.policy)
+		if got := strings.Join(paths(plan), " "); got != tt.want {
+			t.Errorf("policy %d: %s, want %s", tt.policy, got, tt.want)
+		}
+		if !plan[2].Exists || plan[0].Exists {
+			t.Errorf("policy %d: exists = %v, %v", tt.policy, plan[0].Exists, plan[2].Exists)
+		}
+	}
+
+	if DefaultCollision("cbz") != CollisionSkip || DefaultCollision("pdf") != CollisionSkip ||
+		DefaultCollision("images") != CollisionRename {
+		t.Error("DefaultCollision should skip files and rename image directories")
+	}
+
+	// an earlier image download of the same chapter is reused, and only
+	// counts as existing once complete
+	dir := filepath.Join(root, "op", "vol-1")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{Chapter: chapters[0]}
+	if err := m.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	plan := tmpl.Plan(root, nil, chapters[:1], "images", CollisionSkip)
+	if plan[0].Path != dir || plan[0].Exists || plan[0].Skip {
+		t.Errorf("unfinished dir planned as %+v", plan[0])
+	}
+	m.Complete = true
+	if err := m.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	plan = tmpl.Plan(root, nil, chapters[:1], "images", CollisionRename)
+	if plan[0].Path != dir || !plan[0].Exists {
+		t.Errorf("complete dir planned as %+v", plan[0])
+	}
+	plan = tmpl.Plan(root, nil, chapters[1:2], "images", CollisionRename)
+	if want := dir + " (2)"; plan[0].Path != want {
+		t.Errorf("other chapter's dir: planned %s, want %s", plan[0].Path, want)
+	}
+}
@@ -0,0 +1,108 @@
+package mfire
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures a Client. Options are applied in order by NewClient, so
+// later options override earlier ones.
+type Option func(*Client)
+
+// WithProxy routes every request made by the Client through a single proxy.
+// Supported schemes are http, https, socks5 and socks5h. The same proxy is
+// handed to the headless browser used for the VRF fallback.
+func WithProxy(u *url.URL) Option {
+	return func(c *Client) {
+		c.proxy = u
+		c.proxies = nil
+	}
+}
+
+// WithProxyPool rotates requests across the proxies in p. Proxies that keep
+// returning blocks are taken out of rotation; see ProxyPool for details.
+func WithProxyPool(p *ProxyPool) Option {
+	return func(c *Client) {
+		c.proxies = p
+		c.proxy = nil
+	}
+}
+
+// proxyFunc returns the proxy the default transport uses for a request. A
+// proxy pinned on the request context (set by proxyTransport) wins;
+// otherwise the static proxy is used, falling back to the environment
+// (HTTP_PROXY etc.).
+func (c *Client) proxyFunc() func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if p := proxyFromContext(req.Context()); p != nil {
+			return p.url, nil
+		}
+		if c.proxy != nil {
+			return c.proxy, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+}
+
+// WithTransport replaces the Client's underlying HTTP transport, e.g. with
+// a ReplayTransport. Caching and proxy rotation are still layered on top,
+// but proxies only take effect if rt honours them (WithProxy applies to the
+// default transport only), and rt writes headers in its own order rather
+// than the profile's.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.base = rt
+	}
+}
+
+// WithRecorder records every request the Client sends through rec. rec's
+// Base is set to the transport the Client would otherwise use, so proxies,
+// TLS settings and any WithTransport replacement still apply.
+func WithRecorder(rec *RecordingTransport) Option {
+	return func(c *Client) {
+		c.recorder = rec
+	}
+}
+
+// WithCookieJar replaces the Client's in-memory cookie jar, for example with
+// a FileJar so cookies survive restarts.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Client) {
+		c.jar = jar
+	}
+}
+
+// WithCache caches GET responses (pages and ajax alike) in store, serving
+// them for at least minTTL before asking the site again. See CacheTransport.
+func WithCache(store CacheStore, minTTL time.Duration) Option {
+	return func(c *Client) {
+		c.cache = store
+		c.cacheTTL = minTTL
+	}
+}
+
+// WithSelectors makes the Client parse pages with sel instead of
+// DefaultSelectors, typically loaded with LoadSelectors after a site
+// redesign.
+func WithSelectors(sel Selectors) Option {
+	return func(c *Client) {
+		c.parser = NewParser(sel)
+	}
+}
+
+// WithWarnings makes the Client report problems it recovered from, such as a
+// failed session preflight before a search that still succeeded, to fn.
+// Without it they are dropped.
+func WithWarnings(fn func(error)) Option {
+	return func(c *Client) {
+		c.warnings = fn
+	}
+}
+
+// warn reports err through the WithWarnings callback, if any.
+func (c *Client) warn(err error) {
+	if c.warnings != nil {
+		c.warnings(err)
+	}
+}
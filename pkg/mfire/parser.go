@@ -0,0 +1,352 @@
+package mfire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrLayoutChanged is returned (wrapped in a *LayoutError) when a page no
+// longer matches the selectors the parser relies on, which usually means
+// MangaFire changed its markup. Updating the selector table fixes it.
+var ErrLayoutChanged = errors.New("mfire: page layout changed")
+
+// Selectors maps logical element names to CSS selectors. Names containing a
+// dot are resolved relative to the element matched by their parent name
+// ("card.title" is looked up inside each "card").
+type Selectors map[string]string
+
+// DefaultSelectors is the selector table matching the current site layout.
+var DefaultSelectors = Selectors{
+	// listing cards on /home, /filter and the category pages
+	"cards":              ".original.card-lg",
+	"card":               ".unit .inner",
+	"card.title":         ".info > a",
+	"card.cover":         "img",
+	"card.type":          ".type",
+	"card.rating":        ".rating",
+	"card.chapter":       "ul.content[data-name=chap] li a",
+	"card.volume":        "ul.content[data-name=vol] li a",
+	"card.release.date":  "span",
+	"cards.empty":        ".no-result, .empty-result",
+	"pagination":         ".pagination",
+	"pagination.current": ".page-item.active",
+	"pagination.next":    "a[rel=next]",
+	"pagination.last":    "a[rel=last]",
+
+	// ajax quick-search suggestions
+	"suggest":       "a.unit",
+	"suggest.title": ".info h6",
+	"suggest.cover": "img",
+	"suggest.meta":  ".info > div > span",
+
+	// filter form on /filter; the option kind comes from the input name
+	"filter-form":        "form#filters",
+	"filter-form.option": "input[name][type=checkbox], input[name][type=radio]",
+
+	// manga detail page and its chapter lists (ajax)
+	"detail":             "#manga-page",
+	"detail.title":       ".info h1",
+	"detail.alt":         ".info h6",
+	"detail.cover":       ".poster img",
+	"detail.status":      ".info > p",
+	"detail.type":        ".min-info a",
+	"detail.rating":      ".min-info span",
+	"detail.description": ".description",
+	"detail.meta":        ".meta > div",
+	"synopsis":           "#synopsis .modal-content",
+	"languages":          ".m-list .dropdown-item[data-code]",
+	"chapter-list":       "li.item",
+	"chapter-list.link":  "a",
+	"chapter-list.date":  "span",
+	"read-list":          "a[data-id]",
+
+	// home page sections
+	"trending":           "#top-trending .swiper-slide",
+	"trending.link":      ".info .above a",
+	"trending.title":     ".info .above a",
+	"trending.cover":     ".poster img",
+	"most-viewed":        "#most-viewed .tab-content",
+	"most-viewed.item":   ".unit",
+	"most-viewed.link":   "a",
+	"most-viewed.title":  "a > span",
+	"most-viewed.cover":  "img",
+	"updated":            "#recently-updated .tab-content[data-name=all]",
+	"new-releases":       "#new-releases .swiper-slide",
+	"new-releases.link":  "a",
+	"new-releases.title": "a > span",
+	"new-releases.cover": "img",
+}
+
+// LoadSelectors reads a JSON object of selector overrides from path and
+// returns DefaultSelectors with them applied. Unknown names are rejected so
+// typos don't go unnoticed.
+func LoadSelectors(path string) (Selectors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse selectors %s: %w", path, err)
+	}
+	for name := range overrides {
+		if _, ok := DefaultSelectors[name]; !ok {
+			return nil, fmt.Errorf("parse selectors %s: unknown selector %q", path, name)
+		}
+	}
+	return DefaultSelectors.With(overrides), nil
+}
+
+// With returns a copy of s with overrides applied.
+func (s Selectors) With(overrides map[string]string) Selectors {
+	out := make(Selectors, len(s)+len(overrides))
+	for k, v := range s {
+		out[k] = v
+	}
+	for k, v := range overrides {
+		if strings.TrimSpace(v) != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// get returns the selector for name, falling back to DefaultSelectors.
+func (s Selectors) get(name string) string {
+	if v, ok := s[name]; ok && v != "" {
+		return v
+	}
+	return DefaultSelectors[name]
+}
+
+// LayoutError reports the selectors that matched nothing on a page, along
+// with how many elements every selector used did match.
+type LayoutError struct {
+	Page    string
+	Missing []string
+	Matches map[string]int
+}
+
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("%v: %s: no match for %s", ErrLayoutChanged, e.Page, strings.Join(e.Missing, ", "))
+}
+
+// Unwrap lets errors.Is(err, ErrLayoutChanged) match.
+func (e *LayoutError) Unwrap() error { return ErrLayoutChanged }
+
+// Parser extracts data from MangaFire pages using a selector table. The zero
+// value uses DefaultSelectors.
+type Parser struct {
+	Selectors Selectors
+}
+
+// NewParser returns a parser using sel, or DefaultSelectors when nil.
+func NewParser(sel Selectors) *Parser {
+	return &Parser{Selectors: sel}
+}
+
+// diag counts selector matches while parsing a page.
+type diag struct {
+	page    string
+	matches map[string]int
+	missing []string
+}
+
+func newDiag(page string) *diag {
+	return &diag{page: page, matches: make(map[string]int)}
+}
+
+func (d *diag) count(name string, n int) {
+	d.matches[name] += n
+}
+
+// require records name as missing when it matched nothing.
+func (d *diag) require(names ...string) {
+	for _, name := range names {
+		if d.matches[name] == 0 {
+			d.missing = append(d.missing, name)
+		}
+	}
+}
+
+func (d *diag) err() error {
+	if len(d.missing) == 0 {
+		return nil
+	}
+	sort.Strings(d.missing)
+	return &LayoutError{Page: d.page, Missing: d.missing, Matches: d.matches}
+}
+
+// find runs the named selector under s and records the match count.
+func (p *Parser) find(d *diag, s *goquery.Selection, name string) *goquery.Selection {
+	sel := s.Find(p.sel().get(name))
+	d.count(name, sel.Length())
+	return sel
+}
+
+func (p *Parser) sel() Selectors {
+	if p == nil || p.Selectors == nil {
+		return DefaultSelectors
+	}
+	return p.Selectors
+}
+
+// Cards parses the listing cards on a home, filter or category page,
+// returning at most limit results (all of them when limit <= 0). A page
+// with no cards is only an error when it also lacks the "no results"
+// marker.
+func (p *Parser) Cards(doc *goquery.Document, page string, limit int) ([]Manga, error) {
+	d := newDiag(page)
+	mangas := p.cards(d, doc.Selection, limit)
+	return mangas, d.err()
+}
+
+// cards parses the listing cards under root, recording problems in d.
+func (p *Parser) cards(d *diag, root *goquery.Selection, limit int) []Manga {
+	lists := p.find(d, root, "cards")
+	if lists.Length() == 0 {
+		if p.find(d, root, "cards.empty").Length() > 0 {
+			return []Manga{}
+		}
+		d.require("cards")
+		return nil
+	}
+	mangas := make([]Manga, 0)
+	p.find(d, lists, "card").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if limit > 0 && len(mangas) >= limit {
+			return false
+		}
+		a := p.find(d, s, "card.title").First()
+		href, _ := a.Attr("href")
+		m := newManga(a.Text(), href, imgSrc(p.find(d, s, "card.cover")))
+		m.Type = cleanText(p.find(d, s, "card.type").First().Text())
+		m.Rating = parseRating(p.find(d, s, "card.rating").First().Text())
+		for _, kind := range []string{"chapter", "volume"} {
+			p.find(d, s, "card."+kind).Each(func(_ int, a *goquery.Selection) {
+				href, _ := a.Attr("href")
+				if lc, ok := parseLatestChapter(href); ok {
+					lc.Date = parseSiteDate(p.find(d, a, "card.release.date").Last().Text())
+					m.Latest = append(m.Latest, lc)
+				}
+			})
+		}
+		mangas = append(mangas, m)
+		return true
+	})
+	switch {
+	case len(mangas) > 0:
+		d.require("card.title")
+	case p.find(d, lists, "cards.empty").Length() == 0:
+		// the list is there but the cards in it no longer match
+		d.require("card")
+	}
+	return mangas
+}
+
+// newManga builds a listing entry with a trimmed title, absolute URLs and
+// the slug and ID parsed from the manga URL.
+func newManga(title, href, cover string) Manga {
+	m := Manga{Title: cleanText(title), Url: absURL(href), Cover: absURL(cover)}
+	if ref, err := ParseMangaURL(href); err == nil {
+		m.ID, m.Slug = ref.ID, ref.Slug
+	}
+	return m
+}
+
+// parseLatestChapter extracts the kind, language and number from a reader
+// link such as "/read/one-piecee.dkw/en/chapter-1100".
+func parseLatestChapter(href string) (LatestChapter, bool) {
+	ref, err := ParseReaderURL(href)
+	if err != nil {
+		return LatestChapter{}, false
+	}
+	return LatestChapter{
+		Kind:     ref.Kind,
+		Number:   FormatNumber(ref.Number),
+		Language: ref.Language,
+		Url:      absURL(href),
+	}, true
+}
+
+// imgSrc returns an image's source, preferring lazy-loading attributes.
+func imgSrc(img *goquery.Selection) string {
+	for _, attr := range []string{"data-src", "data-original", "src"} {
+		if v, ok := img.First().Attr(attr); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// cleanText trims s and collapses internal runs of whitespace.
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseRating extracts a score such as "8.94" from text, or returns 0.
+func parseRating(s string) float64 {
+	v, err := strconv.ParseFloat(cleanText(s), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// parseSiteDate parses the dates shown next to chapters: absolute ones
+// such as "Dec 06, 2023" and relative ones such as "3 hours ago". It
+// returns the zero time for anything else.
+func parseSiteDate(s string) time.Time {
+	s = cleanText(s)
+	for _, layout := range []string{"Jan 02, 2006", "Jan 2, 2006", "January 2, 2006", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	f := strings.Fields(strings.ToLower(s))
+	if len(f) != 3 || f[2] != "ago" {
+		return time.Time{}
+	}
+	n, err := strconv.Atoi(f[0])
+	if err != nil {
+		if f[0] != "a" && f[0] != "an" {
+			return time.Time{}
+		}
+		n = 1
+	}
+	unit := strings.TrimSuffix(f[1], "s")
+	now := time.Now().UTC()
+	switch unit {
+	case "second":
+		return now.Add(-time.Duration(n) * time.Second)
+	case "minute":
+		return now.Add(-time.Duration(n) * time.Minute)
+	case "hour":
+		return now.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		return now.AddDate(0, 0, -n)
+	case "week":
+		return now.AddDate(0, 0, -7*n)
+	case "month":
+		return now.AddDate(0, -n, 0)
+	case "year":
+		return now.AddDate(-n, 0, 0)
+	}
+	return time.Time{}
+}
+
+// absURL resolves a site-relative href against the MangaFire origin.
+func absURL(href string) string {
+	if parsed, err := url.Parse(href); err == nil && !parsed.IsAbs() && href != "" {
+		return siteURL.ResolveReference(parsed).String()
+	}
+	return href
+}
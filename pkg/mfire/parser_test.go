@@ -0,0 +1,188 @@
+package mfire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// loadFixture parses a saved page from testdata.
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParserCards(t *testing.T) {
+	tests := []struct {
+		fixture string
+		limit   int
+		want    int // cards expected; -1 for any number but none
+	}{
+		{"home.html", 2, 2},
+		{"filter.html", 0, -1},
+		{"filter_empty.html", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := NewParser(nil).Cards(loadFixture(t, tt.fixture), tt.fixture, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want >= 0 && len(got) != tt.want || tt.want < 0 && len(got) == 0 {
+				t.Fatalf("got %d cards, want %d", len(got), tt.want)
+			}
+			dated := tt.want == 0
+			for _, m := range got {
+				checkManga(t, tt.fixture, m)
+				for _, lc := range m.Latest {
+					dated = dated || !lc.Date.IsZero()
+				}
+			}
+			if !dated {
+				t.Error("no latest chapter has a date")
+			}
+		})
+	}
+
+	// the fields of one card, exactly
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div class="original card-lg"><div class="unit"><div class="inner">
+		<a href="/manga/one-piecee.dkw" class="poster"><div><img src="https://static.mfcdn.nl/1/c0/op.jpg" alt="One Piece"></div></a>
+		<div class="info">
+			<div><span class="type">Manga</span><span class="rating"><i class="fa-solid fa-star"></i> 8.94</span></div>
+			<a href="/manga/one-piecee.dkw"> One Piece </a>
+			<ul class="content" data-name="chap">
+				<li><a href="/read/one-piecee.dkw/es-la/chapter-1099"><span>Chap 1099 <b>ES-LA</b></span><span>Dec 01, 2023</span></a></li>
+			</ul>
+			<ul class="content" data-name="vol">
+				<li><a href="/read/one-piecee.dkw/en/volume-107"><span>Vol 107 <b>EN</b></span><span>Nov 03, 2023</span></a></li>
+			</ul>
+		</div>
+	</div></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewParser(nil).Cards(doc, "inline", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Manga{{
+		ID: "dkw", Slug: "one-piecee", Title: "One Piece", Type: "Manga", Rating: 8.94,
+		Url:   "https://mangafire.to/manga/one-piecee.dkw",
+		Cover: "https://static.mfcdn.nl/1/c0/op.jpg",
+		Latest: []LatestChapter{
+			{Kind: "chapter", Number: "1099", Language: "es-la", Date: date(2023, 12, 1), Url: "https://mangafire.to/read/one-piecee.dkw/es-la/chapter-1099"},
+			{Kind: "volume", Number: "107", Language: "en", Date: date(2023, 11, 3), Url: "https://mangafire.to/read/one-piecee.dkw/en/volume-107"},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseSiteDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"Dec 06, 2023", date(2023, 12, 6)},
+		{" Jul 22, 1997 ", date(1997, 7, 22)},
+		{"2023-11-03", date(2023, 11, 3)},
+		{"yesterday-ish", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parseSiteDate(tt.in); !got.Equal(tt.want) {
+			t.Errorf("parseSiteDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if got := parseSiteDate("3 hours ago"); time.Since(got) < 3*time.Hour-time.Minute || time.Since(got) > 3*time.Hour+time.Minute {
+		t.Errorf("parseSiteDate(3 hours ago) = %v", got)
+	}
+}
+
+func TestParserCardsLayoutChanged(t *testing.T) {
+	_, err := NewParser(nil).Cards(loadFixture(t, "home_redesign.html"), "home", 10)
+	if !errors.Is(err, ErrLayoutChanged) {
+		t.Fatalf("err = %v, want ErrLayoutChanged", err)
+	}
+	var le *LayoutError
+	if !errors.As(err, &le) || !reflect.DeepEqual(le.Missing, []string{"cards"}) {
+		t.Errorf("missing = %v, want [cards]", le)
+	}
+
+	// a selector override for the new markup fixes it
+	p := NewParser(DefaultSelectors.With(map[string]string{
+		"cards":      ".grid",
+		"card":       ".manga-card",
+		"card.title": ".manga-card__link",
+	}))
+	got, err := p.Cards(loadFixture(t, "home_redesign.html"), "home", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Url != "https://mangafire.to/manga/one-piecee.dkw" {
+		t.Errorf("got %#v", got)
+	}
+
+	// the list still matches but the cards in it don't, unless it says
+	// there are no results
+	tests := []struct {
+		html    string
+		missing []string
+	}{
+		{`<div class="original card-lg"><article class="manga-card">x</article></div>`, []string{"card"}},
+		{`<div class="original card-lg"><div class="no-result">No manga found</div></div>`, nil},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewParser(nil).Cards(doc, "home", 10)
+		if len(got) != 0 {
+			t.Errorf("%s: got %d cards", tt.html, len(got))
+		}
+		var le *LayoutError
+		errors.As(err, &le)
+		if tt.missing == nil && err != nil || tt.missing != nil && (le == nil || !reflect.DeepEqual(le.Missing, tt.missing)) {
+			t.Errorf("%s: err = %v, want missing %v", tt.html, err, tt.missing)
+		}
+	}
+}
+
+func TestLoadSelectors(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	os.WriteFile(good, []byte(`{"card.title": ".info h6 a"}`), 0o644)
+	sel, err := LoadSelectors(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel["card.title"] != ".info h6 a" || sel["cards"] != DefaultSelectors["cards"] {
+		t.Errorf("unexpected selectors %v", sel)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"crad.title": "a"}`), 0o644)
+	if _, err := LoadSelectors(bad); err == nil {
+		t.Error("expected error for unknown selector name")
+	}
+}
@@ -0,0 +1,343 @@
+package mfire
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDFOptions configures WritePDF. Empty fields are taken from the manga
+// details.
+type PDFOptions struct {
+	Title   string // defaults to the series title and chapter range
+	Author  string // defaults to the authors
+	Subject string // defaults to the first paragraph of the description
+}
+
+// WritePDF writes chapters as one PDF at path. Every image gets a page of
+// its own size (one pixel per point), every chapter a bookmark, and the
+// document info carries the title, author and subject. JPEG pages are
+// embedded as they are; other formats are stored losslessly. The file is
+// written to a temporary file and renamed into place.
+func WritePDF(path string, details *Details, chapters []ExportChapter, opts PDFOptions) error {
+	if len(chapters) == 0 {
+		return ErrNoChapters
+	}
+	var files []string
+	var outline []pdfBookmark
+	for _, ec := range chapters {
+		if len(ec.Files) > 0 {
+			outline = append(outline, pdfBookmark{title: exportLabel(ec.Chapter), page: len(files)})
+		}
+		files = append(files, ec.Files...)
+	}
+	if len(files) == 0 {
+		return ErrNoPages
+	}
+	if opts.Title == "" {
+		opts.Title = exportTitle(details, chapters)
+	}
+	if details != nil {
+		if opts.Author == "" {
+			opts.Author = strings.Join(details.Authors, ", ")
+		}
+		if opts.Subject == "" {
+			opts.Subject, _, _ = strings.Cut(details.Description, "\n\n")
+		}
+	}
+	var keywords string
+	if details != nil {
+		keywords = strings.Join(details.Genres, ", ")
+	}
+	return writeAtomic(path, 0o644, func(w io.Writer) error {
+		pw := &pdfWriter{w: w}
+		return pw.write(files, outline, opts, keywords)
+	})
+}
+
+type pdfBookmark struct {
+	title string
+	page  int // index of the chapter's first page
+}
+
+// pdfWriter writes a PDF object by object, recording offsets for the
+// cross-reference table.
+type pdfWriter struct {
+	w       io.Writer
+	n       int64
+	offsets map[int]int64
+	err     error
+}
+
+func (pw *pdfWriter) printf(format string, args ...interface{}) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, args...)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *pdfWriter) bytes(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *pdfWriter) begin(obj int) {
+	pw.offsets[obj] = pw.n
+	pw.printf("%d 0 obj\n", obj)
+}
+
+func (pw *pdfWriter) end() {
+	pw.printf("endobj\n")
+}
+
+// stream writes obj as a stream object with the given dictionary entries.
+func (pw *pdfWriter) stream(obj int, dict string, data []byte) {
+	pw.begin(obj)
+	pw.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	pw.bytes(data)
+	pw.printf("\nendstream\n")
+	pw.end()
+}
+
+// Object numbers: the fixed objects come first, then three per page
+// (image, content stream, page), then the bookmarks.
+const (
+	pdfCatalog = 1
+	pdfPages   = 2
+	pdfInfo    = 3
+	pdfOutline = 4
+	pdfFirst   = 5
+)
+
+func pdfPageObjs(i int) (img, content, page int) {
+	base := pdfFirst + 3*i
+	return base, base + 1, base + 2
+}
+
+func (pw *pdfWriter) write(files []string, outline []pdfBookmark, opts PDFOptions, keywords string) error {
+	pw.offsets = make(map[int]int64)
+	pw.printf("%%PDF-1.7\n%%\xe2\xe3\xcf\xd3\n")
+
+	pw.begin(pdfCatalog)
+	pw.printf("<< /Type /Catalog /Pages %d 0 R", pdfPages)
+	if len(outline) > 0 {
+		pw.printf(" /Outlines %d 0 R /PageMode /UseOutlines", pdfOutline)
+	}
+	pw.printf(" >>\n")
+	pw.end()
+
+	pw.begin(pdfPages)
+	pw.printf("<< /Type /Pages /Count %d /Kids [", len(files))
+	for i := range files {
+		_, _, page := pdfPageObjs(i)
+		pw.printf(" %d 0 R", page)
+	}
+	pw.printf(" ] >>\n")
+	pw.end()
+
+	pw.begin(pdfInfo)
+	pw.printf("<< /Producer %s /Creator %s /CreationDate %s",
+		pdfString("go-mfire"), pdfString("go-mfire"), pdfString(pdfDate(time.Now())))
+	for _, kv := range [][2]string{{"Title", opts.Title}, {"Author", opts.Author}, {"Subject", opts.Subject}, {"Keywords", keywords}} {
+		if kv[1] != "" {
+			pw.printf(" /%s %s", kv[0], pdfString(kv[1]))
+		}
+	}
+	pw.printf(" >>\n")
+	pw.end()
+
+	for i, file := range files {
+		if err := pw.page(i, file); err != nil {
+			return err
+		}
+	}
+
+	last := pdfFirst + 3*len(files)
+	if len(outline) > 0 {
+		first := last
+		pw.begin(pdfOutline)
+		pw.printf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>\n", first, first+len(outline)-1, len(outline))
+		pw.end()
+		for i, bm := range outline {
+			_, _, page := pdfPageObjs(bm.page)
+			pw.begin(first + i)
+			pw.printf("<< /Title %s /Parent %d 0 R /Dest [%d 0 R /Fit]", pdfString(bm.title), pdfOutline, page)
+			if i > 0 {
+				pw.printf(" /Prev %d 0 R", first+i-1)
+			}
+			if i < len(outline)-1 {
+				pw.printf(" /Next %d 0 R", first+i+1)
+			}
+			pw.printf(" >>\n")
+			pw.end()
+		}
+		last += len(outline)
+	}
+
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", last)
+	for obj := 1; obj < last; obj++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[obj])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", last, pdfCatalog, pdfInfo, xref)
+	return pw.err
+}
+
+// page writes the image, content stream and page object of page i.
+func (pw *pdfWriter) page(i int, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	img, w, h, err := pdfImage(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	imgObj, contentObj, pageObj := pdfPageObjs(i)
+	pw.stream(imgObj, img.dict, img.data)
+	pw.stream(contentObj, "", []byte(fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", w, h)))
+	pw.begin(pageObj)
+	pw.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>\n",
+		pdfPages, w, h, imgObj, contentObj)
+	pw.end()
+	return pw.err
+}
+
+type pdfXObject struct {
+	dict string
+	data []byte
+}
+
+// pdfImage turns an image file into a PDF image XObject. Baseline RGB and
+// gray JPEGs are embedded untouched; anything else is decoded and stored
+// Flate-compressed.
+func pdfImage(data []byte) (pdfXObject, int, int, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return pdfXObject{}, 0, 0, err
+	}
+	if format == "jpeg" {
+		var cs string
+		switch cfg.ColorModel {
+		case color.GrayModel:
+			cs = "/DeviceGray"
+		case color.YCbCrModel:
+			cs = "/DeviceRGB"
+		}
+		if cs != "" {
+			dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+				cfg.Width, cfg.Height, cs)
+			return pdfXObject{dict: dict, data: data}, cfg.Width, cfg.Height, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return pdfXObject{}, 0, 0, err
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var raw []byte
+	cs := "/DeviceRGB"
+	if g, ok := img.(*image.Gray); ok {
+		cs = "/DeviceGray"
+		raw = make([]byte, 0, w*h)
+		for y := 0; y < h; y++ {
+			raw = append(raw, g.Pix[y*g.Stride:y*g.Stride+w]...)
+		}
+	} else {
+		raw = make([]byte, 0, 3*w*h)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				// flatten transparency onto white
+				r, g, bl, a := img.At(x, y).RGBA()
+				r, g, bl = r+(0xffff-a), g+(0xffff-a), bl+(0xffff-a)
+				raw = append(raw, byte(r>>8), byte(g>>8), byte(bl>>8))
+			}
+		}
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		return pdfXObject{}, 0, 0, err
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode",
+		w, h, cs)
+	return pdfXObject{dict: dict, data: buf.Bytes()}, w, h, nil
+}
+
+// pdfString encodes s as a PDF text string: a literal string when it is
+// plain ASCII, UTF-16BE hex otherwise.
+func pdfString(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 || s[i] < 0x20 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+		return "(" + r.Replace(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// pdfDate formats t as a PDF date string.
+func pdfDate(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+// exportTitle is the default title of a book made of chapters: the series
+// title followed by the chapter or chapter range.
+func exportTitle(details *Details, chapters []ExportChapter) string {
+	series := "Manga"
+	if details != nil && details.Title != "" {
+		series = details.Title
+	}
+	first, last := chapters[0].Chapter, chapters[len(chapters)-1].Chapter
+	if len(chapters) == 1 && first.Kind == "volume" {
+		return series + " - Vol. " + FormatNumber(first.Number)
+	}
+	if len(chapters) == 1 {
+		return series + " - Chapter " + FormatNumber(first.Number)
+	}
+	return series + " - Chapters " + FormatNumber(first.Number) + "-" + FormatNumber(last.Number)
+}
+
+// exportLabel is the table of contents entry of a chapter.
+func exportLabel(ch Chapter) string {
+	if ch.Title != "" {
+		return ch.Title
+	}
+	return "Chapter " + FormatNumber(ch.Number)
+}
+
+// DownloadPDF downloads chapters and writes them as one PDF at path, with
+// metadata from details (which may be nil).
+func (d *Downloader) DownloadPDF(ctx context.Context, chapters []Chapter, details *Details, path string, opts PDFOptions) error {
+	return d.downloadExport(ctx, chapters, details, path, func(export []ExportChapter) error {
+		return WritePDF(path, details, export, opts)
+	})
+}
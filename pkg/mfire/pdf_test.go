@@ -0,0 +1,86 @@
+package mfire
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFString(t *testing.T) {
+	tests := map[string]string{
+		"One Piece (2023)": `(One Piece \(2023\))`,
+		"ワンピース":            "<FEFF30EF30F330D430FC30B9>",
+	}
+	for in, want := range tests {
+		if got := pdfString(in); got != want {
+			t.Errorf("pdfString(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	dir := t.TempDir()
+	files := writePages(t, dir, 2, 60, 90)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradient(30, 40), nil); err != nil {
+		t.Fatal(err)
+	}
+	jpg := filepath.Join(dir, "003.jpg")
+	if err := os.WriteFile(jpg, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	details := &Details{Title: "One Piece", Authors: []string{"Oda Eiichiro"}, Description: "Pirates.\n\nMore."}
+	chapters := []ExportChapter{
+		{Chapter: Chapter{Number: 1, Title: "Chapter 1: Romance Dawn"}, Files: files},
+		{Chapter: Chapter{Number: 2}, Files: []string{jpg}},
+	}
+	path := filepath.Join(dir, "op.pdf")
+	if err := WritePDF(path, details, chapters, PDFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := string(data)
+
+	for _, want := range []string{
+		"/Type /Pages /Count 3",
+		"/MediaBox [0 0 60 90]",
+		"/MediaBox [0 0 30 40]",
+		"/Filter /DCTDecode",
+		"/Title (One Piece - Chapters 1-2)",
+		"/Author (Oda Eiichiro)",
+		"/Subject (Pirates.)",
+		"/Title (Chapter 1: Romance Dawn)",
+		"/Title (Chapter 2)",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF lacks %s", want)
+		}
+	}
+	if !bytes.Contains(data, buf.Bytes()) {
+		t.Error("JPEG page wasn't embedded as is")
+	}
+
+	// every cross-reference entry must point at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindStringSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(m[1])
+	lines := strings.Split(pdf[xref:], "\n")
+	size, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for obj := 1; obj < size; obj++ {
+		off, _ := strconv.Atoi(strings.Fields(lines[2+obj])[0])
+		if !strings.HasPrefix(pdf[off:], fmt.Sprintf("%d 0 obj\n", obj)) {
+			t.Errorf("xref entry %d points at %q", obj, pdf[off:off+10])
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package mfire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ImageProfile is a set of conversions applied to downloaded pages before
+// they are saved or packed (see Downloader.Process). Conversions run in
+// this order: auto-crop, spread splitting, resizing, grayscale, encoding.
+// Pages nothing applies to are kept byte for byte.
+type ImageProfile struct {
+	Name string `json:"name"`
+	// Format is the output format, "jpeg" or "png". Empty keeps JPEG and
+	// PNG pages in their format and converts others (WebP, GIF) to JPEG.
+	Format string `json:"format,omitempty"`
+	// MaxWidth and MaxHeight scale larger pages down, keeping their aspect
+	// ratio. Zero means no limit.
+	MaxWidth  int  `json:"maxWidth,omitempty"`
+	MaxHeight int  `json:"maxHeight,omitempty"`
+	Grayscale bool `json:"grayscale,omitempty"`
+	// JPEGQuality is used for pages encoded as JPEG; 0 means 85.
+	JPEGQuality int `json:"jpegQuality,omitempty"`
+	// AutoCrop trims white borders.
+	AutoCrop bool `json:"autoCrop,omitempty"`
+	// SplitSpreads cuts pages wider than they are tall into two, ordered
+	// for the manga's reading direction.
+	SplitSpreads bool `json:"splitSpreads,omitempty"`
+}
+
+// Built-in image profiles. Device profiles are available too, see
+// LookupImageProfile.
+var imageProfiles = []ImageProfile{
+	{Name: "convert"},
+	{Name: "lossless", Format: "png"},
+	{Name: "compact", MaxHeight: 1600, JPEGQuality: 75, AutoCrop: true},
+	{Name: "eink", MaxWidth: 1264, MaxHeight: 1680, Grayscale: true, JPEGQuality: 80, AutoCrop: true, SplitSpreads: true},
+}
+
+// LookupImageProfile returns the built-in image profile with the given
+// name, or the one derived from the device profile of that name.
+func LookupImageProfile(name string) (ImageProfile, bool) {
+	for _, p := range imageProfiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	if d, ok := LookupDevice(name); ok {
+		return d.ImageProfile(), true
+	}
+	return ImageProfile{}, false
+}
+
+// ImageProfileNames lists the built-in image profiles, device profiles
+// included.
+func ImageProfileNames() []string {
+	names := make([]string, 0, len(imageProfiles)+len(deviceProfiles))
+	for _, p := range imageProfiles {
+		names = append(names, p.Name)
+	}
+	return append(names, DeviceNames()...)
+}
+
+// LoadImageProfile reads an image profile from a JSON file.
+func LoadImageProfile(path string) (ImageProfile, error) {
+	var p ImageProfile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("load image profile %s: %w", path, err)
+	}
+	switch p.Format {
+	case "", "jpeg", "png":
+	default:
+		return p, fmt.Errorf("image profile %s: unknown format %q", path, p.Format)
+	}
+	if p.Name == "" {
+		p.Name = filepath.Base(path)
+	}
+	return p, nil
+}
+
+// ImageProfile returns the page conversions matching the device: pages
+// cropped, spreads split and scaled to the screen, in gray for e-ink.
+func (d DeviceProfile) ImageProfile() ImageProfile {
+	return ImageProfile{
+		Name:         d.Name,
+		MaxWidth:     d.Width,
+		MaxHeight:    d.Height,
+		Grayscale:    d.Grayscale,
+		JPEGQuality:  d.quality(),
+		AutoCrop:     true,
+		SplitSpreads: true,
+	}
+}
+
+// ProcessPages applies p to the page files in order and writes the
+// results to dir as 001.jpg, 002.png, ..., returning the new files. Split
+// spreads become two files, so there may be more files than pages; rtl
+// puts the right half of a spread first.
+func ProcessPages(files []string, dir string, p ImageProfile, rtl bool) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	type result struct {
+		pages []processedPage
+		err   error
+	}
+	results := make([]result, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				pages, err := p.process(files[i], rtl)
+				if err != nil {
+					err = fmt.Errorf("%s: %w", files[i], err)
+				}
+				results[i] = result{pages, err}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	n := 0
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		n += len(r.pages)
+	}
+	width := len(strconv.Itoa(n))
+	if width < 3 {
+		width = 3
+	}
+	out := make([]string, 0, n)
+	for _, r := range results {
+		for _, pg := range r.pages {
+			path := filepath.Join(dir, fmt.Sprintf("%0*d%s", width, len(out)+1, pg.ext))
+			if err := writeFileAtomic(path, pg.data, 0o644); err != nil {
+				return nil, err
+			}
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
+
+type processedPage struct {
+	data []byte
+	ext  string
+}
+
+// process converts one page file into one or two pages.
+func (p ImageProfile) process(file string, rtl bool) ([]processedPage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if p.AutoCrop {
+		if r := cropBounds(img); r != img.Bounds() {
+			img, changed = subImage(img, r), true
+		}
+	}
+	parts := []image.Image{img}
+	if b := img.Bounds(); p.SplitSpreads && b.Dx() > b.Dy() {
+		mid := b.Min.X + b.Dx()/2
+		left := subImage(img, image.Rect(b.Min.X, b.Min.Y, mid, b.Max.Y))
+		right := subImage(img, image.Rect(mid, b.Min.Y, b.Max.X, b.Max.Y))
+		parts, changed = []image.Image{left, right}, true
+		if rtl {
+			parts[0], parts[1] = right, left
+		}
+	}
+
+	target := p.Format
+	if target == "" {
+		switch format {
+		case "jpeg", "png":
+			target = format
+		default:
+			target = "jpeg"
+		}
+	}
+	out := make([]processedPage, len(parts))
+	for i, part := range parts {
+		before := part.Bounds()
+		part = fitImage(part, p.MaxWidth, p.MaxHeight)
+		resized := part.Bounds().Dx() != before.Dx() || part.Bounds().Dy() != before.Dy()
+		gray := false
+		if _, ok := part.(*image.Gray); p.Grayscale && !ok {
+			part, gray = grayscale(part), true
+		}
+		if !changed && !resized && !gray && target == format {
+			out[i] = processedPage{data: data, ext: imageExt(format)}
+			continue
+		}
+		var buf bytes.Buffer
+		quality := p.JPEGQuality
+		if quality <= 0 {
+			quality = 85
+		}
+		ext, err := encodeImage(&buf, part, target, quality)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = processedPage{data: buf.Bytes(), ext: ext}
+	}
+	return out, nil
+}
+
+// subImage returns the part of img within r.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dst.Set(x-r.Min.X, y-r.Min.Y, img.At(x, y))
+		}
+	}
+	return dst
+}
+
+// Auto-crop treats pixels at least this light as white, and a row or
+// column as border while no more than one in cropNoise of its pixels (and
+// at least one) are darker, so JPEG noise and specks don't stop the crop.
+const (
+	cropWhite = 0xe6
+	cropNoise = 200
+)
+
+// noise is the number of dark pixels a row or column of n can have and
+// still count as border.
+func noise(n int) int {
+	if n < 2*cropNoise {
+		return 1
+	}
+	return n / cropNoise
+}
+
+// cropBounds returns the bounds of img without its white borders. Blank
+// pages, and pages that would lose more than 80% of their area, are left
+// whole.
+func cropBounds(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	dark := func(x, y int) bool {
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < cropWhite
+	}
+	rowContent := func(y int) bool {
+		n := 0
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if dark(x, y) {
+				n++
+			}
+		}
+		return n > noise(b.Dx())
+	}
+	colContent := func(x, minY, maxY int) bool {
+		n := 0
+		for y := minY; y < maxY; y++ {
+			if dark(x, y) {
+				n++
+			}
+		}
+		return n > noise(maxY-minY)
+	}
+	r := b
+	for r.Min.Y < r.Max.Y && !rowContent(r.Min.Y) {
+		r.Min.Y++
+	}
+	for r.Max.Y > r.Min.Y && !rowContent(r.Max.Y-1) {
+		r.Max.Y--
+	}
+	for r.Min.X < r.Max.X && !colContent(r.Min.X, r.Min.Y, r.Max.Y) {
+		r.Min.X++
+	}
+	for r.Max.X > r.Min.X && !colContent(r.Max.X-1, r.Min.Y, r.Max.Y) {
+		r.Max.X--
+	}
+	if r.Empty() || r.Dx()*r.Dy()*5 < b.Dx()*b.Dy() {
+		return b
+	}
+	return r
+}
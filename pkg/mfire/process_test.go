@@ -0,0 +1,129 @@
+package mfire
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// framed returns a w x h white image with a black w-2m x h-2m rectangle in
+// the middle, whose left half is red when marked.
+func framed(w, h, m int, marked bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	inner := image.Rect(m, m, w-m, h-m)
+	draw.Draw(img, inner, image.Black, image.Point{}, draw.Src)
+	if marked {
+		left := image.Rect(m, m, w/2, h-m)
+		draw.Draw(img, left, image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestCropBounds(t *testing.T) {
+	img := framed(100, 150, 10, false)
+	img.Set(3, 3, color.Black) // a speck in the margin
+	if got, want := cropBounds(img), image.Rect(10, 10, 90, 140); got != want {
+		t.Errorf("crop = %v, want %v", got, want)
+	}
+	blank := framed(100, 150, 50, false) // nothing but margin
+	if got := cropBounds(blank); got != blank.Bounds() {
+		t.Errorf("blank page cropped to %v", got)
+	}
+	small := framed(100, 150, 40, false) // content under 20% of the page
+	if got := cropBounds(small); got != small.Bounds() {
+		t.Errorf("mostly empty page cropped to %v", got)
+	}
+}
+
+func TestProcessPages(t *testing.T) {
+	src := t.TempDir()
+	write := func(name string, img image.Image) string {
+		path := filepath.Join(src, name)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	files := []string{
+		write("001.png", framed(60, 90, 0, false)),   // untouched
+		write("002.png", framed(220, 110, 10, true)), // spread with margins
+		write("003.png", framed(300, 400, 0, false)), // too big
+	}
+
+	decode := func(path string) (image.Image, string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img, format
+	}
+
+	p := ImageProfile{MaxWidth: 150, MaxHeight: 200, AutoCrop: true, SplitSpreads: true}
+	out, err := ProcessPages(files, filepath.Join(t.TempDir(), "rtl"), p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 4 {
+		t.Fatalf("got %d pages, want 4: %v", len(out), out)
+	}
+	orig, _ := os.ReadFile(files[0])
+	if got, _ := os.ReadFile(out[0]); !bytes.Equal(got, orig) {
+		t.Error("page 1 needed no conversion but was re-encoded")
+	}
+	// right to left: the right (black) half of the spread comes first
+	right, _ := decode(out[1])
+	left, _ := decode(out[2])
+	if b := right.Bounds(); b.Dx() != 100 || b.Dy() != 90 {
+		t.Errorf("split half is %v, want 100x90", b)
+	}
+	if r, _, _, _ := right.At(5, 5).RGBA(); r != 0 {
+		t.Errorf("first half is not the right half")
+	}
+	if r, _, _, _ := left.At(5, 5).RGBA(); r != 0xffff {
+		t.Errorf("second half is not the left half")
+	}
+	if big, _ := decode(out[3]); big.Bounds().Dx() != 150 || big.Bounds().Dy() != 200 {
+		t.Errorf("page 3 is %v, want 150x200", big.Bounds())
+	}
+
+	p = ImageProfile{Format: "jpeg", Grayscale: true, SplitSpreads: true}
+	out, err = ProcessPages(files[1:2], filepath.Join(t.TempDir(), "ltr"), p, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || filepath.Ext(out[0]) != ".jpg" {
+		t.Fatalf("got %v, want two JPEGs", out)
+	}
+	first, format := decode(out[0])
+	if format != "jpeg" || first.ColorModel() != color.GrayModel {
+		t.Errorf("page is %s %T, want gray jpeg", format, first.ColorModel())
+	}
+	// left to right: the marked half first
+	if y := first.At(40, 50).(color.Gray).Y; y < 40 || y > 110 {
+		t.Errorf("first half gray at the red mark = %d, want red's luminance", y)
+	}
+
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, framed(10, 10, 0, false), nil)
+	if err := os.WriteFile(filepath.Join(src, "bad.png"), buf.Bytes()[:20], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProcessPages([]string{filepath.Join(src, "bad.png")}, t.TempDir(), p, false); err == nil {
+		t.Error("truncated page processed without error")
+	}
+}
@@ -0,0 +1,208 @@
+package mfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHealthyProxy is returned when every proxy in a ProxyPool has been
+// taken out of rotation.
+var ErrNoHealthyProxy = errors.New("mfire: no healthy proxy available")
+
+// ProxyPool rotates requests across a set of proxies in round-robin order and
+// tracks their health. A proxy that returns a block (403, 407, 429 or 503) or
+// fails at the transport level MaxFailures times in a row is dropped from
+// rotation for Cooldown; any successful response resets its failure count.
+// A ProxyPool is safe for concurrent use.
+type ProxyPool struct {
+	// MaxFailures is the number of consecutive failures after which a proxy
+	// is dropped. Defaults to 3.
+	MaxFailures int
+	// Cooldown is how long a dropped proxy stays out of rotation. A zero
+	// value drops it permanently.
+	Cooldown time.Duration
+
+	mu      sync.Mutex
+	proxies []*poolProxy
+	next    int
+}
+
+type poolProxy struct {
+	url       *url.URL
+	failures  int
+	downUntil time.Time
+	dropped   bool
+}
+
+// NewProxyPool parses the given proxy URLs and returns a pool that rotates
+// across them. Each URL must use the http, https, socks5 or socks5h scheme.
+func NewProxyPool(rawurls ...string) (*ProxyPool, error) {
+	if len(rawurls) == 0 {
+		return nil, errors.New("mfire: empty proxy list")
+	}
+	p := &ProxyPool{MaxFailures: 3, Cooldown: 10 * time.Minute}
+	for _, raw := range rawurls {
+		u, err := ParseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &poolProxy{url: u})
+	}
+	return p, nil
+}
+
+// ParseProxyURL parses and validates a proxy URL. A missing scheme is treated
+// as http, so "127.0.0.1:8080" is accepted.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %q", raw, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// pick returns the next healthy proxy in rotation.
+func (p *ProxyPool) pick() (*poolProxy, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for i := 0; i < len(p.proxies); i++ {
+		pp := p.proxies[(p.next+i)%len(p.proxies)]
+		if pp.dropped {
+			if p.Cooldown <= 0 || now.Before(pp.downUntil) {
+				continue
+			}
+			// cooldown elapsed: give it another chance
+			pp.dropped = false
+			pp.failures = 0
+		}
+		p.next = (p.next + i + 1) % len(p.proxies)
+		return pp, nil
+	}
+	return nil, ErrNoHealthyProxy
+}
+
+// report records the outcome of a request made through pp.
+func (p *ProxyPool) report(pp *poolProxy, resp *http.Response, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil && !isBlockStatus(resp.StatusCode) {
+		pp.failures = 0
+		return
+	}
+	pp.failures++
+	limit := p.MaxFailures
+	if limit <= 0 {
+		limit = 3
+	}
+	if pp.failures >= limit {
+		pp.dropped = true
+		pp.downUntil = time.Now().Add(p.Cooldown)
+	}
+}
+
+// Healthy returns the proxies currently in rotation.
+func (p *ProxyPool) Healthy() []*url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	out := make([]*url.URL, 0, len(p.proxies))
+	for _, pp := range p.proxies {
+		if pp.dropped && (p.Cooldown <= 0 || now.Before(pp.downUntil)) {
+			continue
+		}
+		out = append(out, pp.url)
+	}
+	return out
+}
+
+func isBlockStatus(code int) bool {
+	switch code {
+	case http.StatusForbidden, http.StatusProxyAuthRequired, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+type proxyCtxKey struct{}
+
+// withProxy pins pp on ctx so every request made with it (including
+// redirects) exits through the same proxy.
+func withProxy(ctx context.Context, pp *poolProxy) context.Context {
+	if pp == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, proxyCtxKey{}, pp)
+}
+
+func proxyFromContext(ctx context.Context) *poolProxy {
+	pp, _ := ctx.Value(proxyCtxKey{}).(*poolProxy)
+	return pp
+}
+
+// proxyTransport picks a proxy from the pool for each request that doesn't
+// already have one pinned and reports the outcome back to the pool.
+type proxyTransport struct {
+	pool *ProxyPool
+	base http.RoundTripper
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pp := proxyFromContext(req.Context())
+	if pp == nil {
+		var err error
+		if pp, err = t.pool.pick(); err != nil {
+			return nil, err
+		}
+		req = req.Clone(withProxy(req.Context(), pp))
+	}
+	resp, err := t.base.RoundTrip(req)
+	t.pool.report(pp, resp, err)
+	return resp, err
+}
+
+// browserProxy returns the proxy the headless browser should use, along with
+// the context that pins the HTTP client to the same proxy. Chrome's
+// --proxy-server flag doesn't accept credentials, so userinfo is dropped.
+func (c *Client) browserProxy(ctx context.Context) (string, context.Context, error) {
+	var u *url.URL
+	switch {
+	case c.proxies != nil:
+		pp := proxyFromContext(ctx)
+		if pp == nil {
+			var err error
+			if pp, err = c.proxies.pick(); err != nil {
+				return "", ctx, err
+			}
+			ctx = withProxy(ctx, pp)
+		}
+		u = pp.url
+	case c.proxy != nil:
+		u = c.proxy
+	default:
+		return "", ctx, nil
+	}
+	scheme := u.Scheme
+	if scheme == "socks5h" {
+		scheme = "socks5"
+	}
+	return scheme + "://" + u.Host, ctx, nil
+}
@@ -0,0 +1,102 @@
+package mfire
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProxyURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"127.0.0.1:8080", "http://127.0.0.1:8080", true},
+		{" socks5h://user:pw@proxy:1080 ", "socks5h://user:pw@proxy:1080", true},
+		{"https://proxy", "https://proxy", true},
+		{"ftp://proxy:21", "", false},
+		{"http://", "", false},
+		{"http://[::1", "", false},
+	}
+	for _, tt := range tests {
+		u, err := ParseProxyURL(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: err = %v", tt.in, err)
+			continue
+		}
+		if tt.ok && u.String() != tt.want {
+			t.Errorf("%q = %s, want %s", tt.in, u, tt.want)
+		}
+	}
+}
+
+func TestProxyPool(t *testing.T) {
+	ok := &http.Response{StatusCode: 200}
+	blocked := &http.Response{StatusCode: 403}
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		// steps are picks and reports: "a" expects proxy a to be picked,
+		// "a+" and "a-" report a success and a failure through it, "~"
+		// ends every cooldown, "!" expects no proxy at all
+		steps   string
+		healthy string
+	}{
+		{"round robin", time.Hour, "a b c a b", "a b c"},
+		{"drop after failures", time.Hour, "a- a- a- b c b", "b c"},
+		{"success resets", time.Hour, "a- a- a+ a- a- a b c a", "a b c"},
+		{"blocks count", time.Hour, "b! b! b! a c a", "a c"},
+		{"all dropped", time.Hour, "a- a- a- b- b- b- c- c- c- !", ""},
+		{"cooldown ends", time.Hour, "a- a- a- b c ~ a b", "a b c"},
+		{"cooldown restarts count", time.Hour, "a- a- a- b ~ c a a- b c a", "a b c"},
+		{"no cooldown", 0, "a- a- a- ~ b c b", "b c"},
+	}
+	for _, tt := range tests {
+		p, err := NewProxyPool("http://a:1", "http://b:1", "http://c:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Cooldown = tt.cooldown
+		byHost := make(map[string]*poolProxy)
+		for _, pp := range p.proxies {
+			byHost[pp.url.Hostname()] = pp
+		}
+		for _, step := range strings.Fields(tt.steps) {
+			switch {
+			case step == "~":
+				for _, pp := range p.proxies {
+					pp.downUntil = time.Time{}
+				}
+			case step == "!":
+				if pp, err := p.pick(); !errors.Is(err, ErrNoHealthyProxy) {
+					t.Errorf("%s: picked %v, want ErrNoHealthyProxy", tt.name, pp.url)
+				}
+			case len(step) == 2:
+				pp := byHost[step[:1]]
+				switch step[1] {
+				case '+':
+					p.report(pp, ok, nil)
+				case '-':
+					p.report(pp, nil, errors.New("connection refused"))
+				case '!':
+					p.report(pp, blocked, nil)
+				}
+			default:
+				pp, err := p.pick()
+				if err != nil || pp.url.Hostname() != step {
+					t.Errorf("%s: picked %v, %v; want %s", tt.name, pp, err, step)
+				}
+			}
+		}
+		var healthy []string
+		for _, u := range p.Healthy() {
+			healthy = append(healthy, u.Hostname())
+		}
+		if got := strings.Join(healthy, " "); got != tt.healthy {
+			t.Errorf("%s: healthy = %q, want %q", tt.name, got, tt.healthy)
+		}
+	}
+}
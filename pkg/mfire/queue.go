@@ -0,0 +1,564 @@
+package mfire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned for a job ID the queue doesn't have.
+var ErrJobNotFound = errors.New("mfire: no such job")
+
+// JobState is the state of a queued download.
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"   // waiting to run, possibly for a retry
+	JobRunning  JobState = "running"  // being downloaded
+	JobPaused   JobState = "paused"   // held until resumed
+	JobDone     JobState = "done"     // downloaded
+	JobFailed   JobState = "failed"   // out of attempts, or failed permanently
+	JobCanceled JobState = "canceled" // cancelled by the user
+)
+
+// Job is one chapter download in a Queue.
+type Job struct {
+	ID      int     `json:"id"`
+	Chapter Chapter `json:"chapter"`
+	// Bundle, for a volume packed into one file, holds its chapters;
+	// Chapter then describes the volume (see VolumeGroup.Chapter).
+	Bundle []Chapter `json:"bundle,omitempty"`
+	// Format is "images" (the default), "cbz", "epub" or "pdf".
+	Format string `json:"format,omitempty"`
+	// Path is the directory for images, the file otherwise.
+	Path string `json:"path"`
+	// Device is a DeviceProfile name pages are converted for, EPUB only.
+	Device string `json:"device,omitempty"`
+	// Process, when set, converts the pages (see Downloader.Process).
+	Process *ImageProfile `json:"process,omitempty"`
+	// Priority orders the queue: higher runs first, ties in the order added.
+	Priority int      `json:"priority,omitempty"`
+	State    JobState `json:"state"`
+	Attempts int      `json:"attempts,omitempty"`
+	// NextAttempt holds a queued job back until then after a failure.
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Added       time.Time `json:"added"`
+	Updated     time.Time `json:"updated"`
+}
+
+// queueFile is the on-disk form of a Queue.
+type queueFile struct {
+	NextID int    `json:"nextId"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+// Queue is a durable list of chapter downloads kept in a JSON file. Every
+// method reads the file, applies its change and writes it back under a
+// lock file, so a `mfire queue` command in one process can pause or cancel
+// jobs that a QueueRunner in another is working on.
+type Queue struct {
+	path string
+}
+
+// OpenQueue opens the queue stored at path, creating it if needed.
+func OpenQueue(path string) (*Queue, error) {
+	q := &Queue{path: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return q, q.update(func(*queueFile) error { return nil })
+	}
+	_, err := q.load()
+	return q, err
+}
+
+// Path returns the queue's file.
+func (q *Queue) Path() string { return q.path }
+
+func (q *Queue) load() (*queueFile, error) {
+	qf := &queueFile{NextID: 1}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return qf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, qf); err != nil {
+		return nil, fmt.Errorf("load queue %s: %w", q.path, err)
+	}
+	return qf, nil
+}
+
+// update applies fn to the queue under the lock and saves the result
+// unless fn fails.
+func (q *Queue) update(fn func(*queueFile) error) error {
+	unlock, err := lockFile(q.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	qf, err := q.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(qf); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(qf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path, append(data, '\n'), 0o644)
+}
+
+// lockFile takes an exclusive lock by creating path, waiting up to ten
+// seconds for another holder. Locks older than a minute are assumed to be
+// left by a crashed process and taken over.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > time.Minute {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("queue locked: %s", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Add appends jobs to the queue and returns them with their IDs assigned.
+func (q *Queue) Add(jobs ...Job) ([]Job, error) {
+	out := make([]Job, len(jobs))
+	err := q.update(func(qf *queueFile) error {
+		now := time.Now().UTC()
+		for i, j := range jobs {
+			if j.Format == "" {
+				j.Format = "images"
+			}
+			j.ID, j.State, j.Attempts, j.Error = qf.NextID, JobQueued, 0, ""
+			j.NextAttempt, j.Added, j.Updated = time.Time{}, now, now
+			qf.NextID++
+			job := j
+			qf.Jobs = append(qf.Jobs, &job)
+			out[i] = j
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Jobs returns every job in run order: by priority, then as added.
+func (q *Queue) Jobs() ([]Job, error) {
+	qf, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	sortJobs(qf.Jobs)
+	out := make([]Job, len(qf.Jobs))
+	for i, j := range qf.Jobs {
+		out[i] = *j
+	}
+	return out, nil
+}
+
+func sortJobs(jobs []*Job) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
+
+// Pause holds queued or running jobs. A running job is stopped by its
+// runner; the pages it already saved are kept for when it resumes.
+func (q *Queue) Pause(ids ...int) error {
+	return q.transition(ids, JobPaused, JobQueued, JobRunning)
+}
+
+// Resume queues paused, failed or cancelled jobs again, with a fresh set
+// of attempts.
+func (q *Queue) Resume(ids ...int) error {
+	return q.transition(ids, JobQueued, JobPaused, JobFailed, JobCanceled)
+}
+
+// Cancel drops queued, running or paused jobs. Canceled jobs stay listed
+// until Prune.
+func (q *Queue) Cancel(ids ...int) error {
+	return q.transition(ids, JobCanceled, JobQueued, JobRunning, JobPaused)
+}
+
+// transition moves jobs in one of the from states to state. Nothing changes
+// when any job is missing or in another state.
+func (q *Queue) transition(ids []int, state JobState, from ...JobState) error {
+	return q.update(func(qf *queueFile) error {
+		var jobs []*Job
+		for _, id := range ids {
+			j := qf.find(id)
+			if j == nil {
+				return fmt.Errorf("%w: %d", ErrJobNotFound, id)
+			}
+			ok := false
+			for _, s := range from {
+				ok = ok || j.State == s
+			}
+			if !ok {
+				return fmt.Errorf("job %d is %s", id, j.State)
+			}
+			jobs = append(jobs, j)
+		}
+		now := time.Now().UTC()
+		for _, j := range jobs {
+			j.State, j.Updated = state, now
+			if state == JobQueued {
+				j.Attempts, j.NextAttempt, j.Error = 0, time.Time{}, ""
+			}
+		}
+		return nil
+	})
+}
+
+// SetPriority changes the priority of a job.
+func (q *Queue) SetPriority(id, priority int) error {
+	return q.update(func(qf *queueFile) error {
+		j := qf.find(id)
+		if j == nil {
+			return fmt.Errorf("%w: %d", ErrJobNotFound, id)
+		}
+		j.Priority, j.Updated = priority, time.Now().UTC()
+		return nil
+	})
+}
+
+// Prune removes done and cancelled jobs and returns how many it removed.
+func (q *Queue) Prune() (int, error) {
+	n := 0
+	err := q.update(func(qf *queueFile) error {
+		kept := qf.Jobs[:0]
+		for _, j := range qf.Jobs {
+			if j.State == JobDone || j.State == JobCanceled {
+				n++
+				continue
+			}
+			kept = append(kept, j)
+		}
+		qf.Jobs = kept
+		return nil
+	})
+	return n, err
+}
+
+func (qf *queueFile) find(id int) *Job {
+	for _, j := range qf.Jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// QueueRunner works through a Queue with a Downloader. Requests go through
+// the Downloader's Client, so its rate limit (WithRateLimit) and per-host
+// limit (WithHostLimit) apply across all jobs.
+type QueueRunner struct {
+	Queue      *Queue
+	Downloader *Downloader
+	// Jobs is the number of chapters downloaded at once. Defaults to 1.
+	Jobs int
+	// MaxAttempts is how often a job is tried before it is marked failed.
+	// Defaults to 5.
+	MaxAttempts int
+	// RetryDelay is the wait after a job's first failure, doubling with
+	// every further one up to an hour. Defaults to 30 seconds.
+	RetryDelay time.Duration
+	// Poll is how often the queue file is checked for changes made by
+	// other processes. Defaults to one second.
+	Poll time.Duration
+	// OnChange, when set, is called whenever the runner changes a job's
+	// state.
+	OnChange func(Job)
+
+	mu      sync.Mutex
+	details map[string]*Details
+}
+
+// Run downloads queued jobs until none are left, waiting out scheduled
+// retries, or until ctx is done. Jobs paused or cancelled while running
+// are stopped. Only one runner should work on a queue at a time: jobs left
+// running by an earlier runner are queued again when Run starts.
+func (r *QueueRunner) Run(ctx context.Context) error {
+	workers := r.Jobs
+	if workers <= 0 {
+		workers = 1
+	}
+	poll := r.Poll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	err := r.Queue.update(func(qf *queueFile) error {
+		for _, j := range qf.Jobs {
+			if j.State == JobRunning {
+				j.State = JobQueued
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		id  int
+		err error
+	}
+	running := make(map[int]context.CancelFunc)
+	results := make(chan result)
+	var stopped []result // received after ctx ended, not yet recorded
+	defer func() {
+		for _, cancel := range running {
+			cancel()
+		}
+		for len(running) > 0 {
+			res := <-results
+			delete(running, res.id)
+			stopped = append(stopped, res)
+		}
+		// jobs that finished before noticing are recorded; interrupted
+		// ones run again next time
+		var interrupted []int
+		for _, res := range stopped {
+			if res.err == nil {
+				r.finish(res.id, nil)
+			} else {
+				interrupted = append(interrupted, res.id)
+			}
+		}
+		r.Queue.update(func(qf *queueFile) error {
+			for _, id := range interrupted {
+				if j := qf.find(id); j != nil && j.State == JobRunning {
+					j.State = JobQueued
+				}
+			}
+			return nil
+		})
+	}()
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		var claimed []Job
+		var stop []int
+		waiting := false
+		err := r.Queue.update(func(qf *queueFile) error {
+			for id := range running {
+				if j := qf.find(id); j == nil || j.State != JobRunning {
+					stop = append(stop, id)
+				}
+			}
+			sortJobs(qf.Jobs)
+			now := time.Now()
+			for _, j := range qf.Jobs {
+				if j.State != JobQueued {
+					continue
+				}
+				if len(running)+len(claimed) >= workers || j.NextAttempt.After(now) {
+					waiting = true
+					continue
+				}
+				j.State, j.Updated = JobRunning, now.UTC()
+				claimed = append(claimed, *j)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range stop {
+			running[id]()
+		}
+		for _, j := range claimed {
+			r.changed(j)
+			jctx, cancel := context.WithCancel(ctx)
+			running[j.ID] = cancel
+			go func(j Job) {
+				results <- result{j.ID, r.run(jctx, j)}
+			}(j)
+		}
+		if len(running) == 0 && !waiting {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case res := <-results:
+			running[res.id]()
+			delete(running, res.id)
+			if ctx.Err() != nil {
+				stopped = append(stopped, res)
+				return ctx.Err()
+			}
+			if err := r.finish(res.id, res.err); err != nil {
+				return err
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// finish records the outcome of a job unless it was paused or cancelled
+// while running.
+func (r *QueueRunner) finish(id int, jobErr error) error {
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	var changed *Job
+	err := r.Queue.update(func(qf *queueFile) error {
+		j := qf.find(id)
+		if j == nil || j.State != JobRunning {
+			return nil
+		}
+		now := time.Now().UTC()
+		j.Updated = now
+		switch {
+		case jobErr == nil:
+			j.State, j.Error, j.NextAttempt = JobDone, "", time.Time{}
+		default:
+			j.Attempts++
+			j.Error = jobErr.Error()
+			if j.Attempts >= maxAttempts || permanent(jobErr) {
+				j.State = JobFailed
+			} else {
+				j.State, j.NextAttempt = JobQueued, now.Add(r.retryDelay(j.Attempts))
+			}
+		}
+		c := *j
+		changed = &c
+		return nil
+	})
+	if err == nil && changed != nil {
+		r.changed(*changed)
+	}
+	return err
+}
+
+// retryDelay is the wait before the next attempt after n failures.
+func (r *QueueRunner) retryDelay(n int) time.Duration {
+	d := r.RetryDelay
+	if d <= 0 {
+		d = 30 * time.Second
+	}
+	for i := 1; i < n && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// permanent reports whether retrying a failed job is pointless: the site
+// answered with a client error other than a block (403 or 429), which
+// clears once the session or proxy changes, or the chapter is gone.
+func permanent(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 400 && se.Code < 500 && se.Code != 403 && se.Code != 429
+	}
+	return errors.Is(err, ErrNoPages) || errors.Is(err, ErrChapterNotFound)
+}
+
+func (r *QueueRunner) changed(j Job) {
+	if r.OnChange != nil {
+		r.OnChange(j)
+	}
+}
+
+// run downloads one job.
+func (r *QueueRunner) run(ctx context.Context, j Job) error {
+	d := r.Downloader
+	if j.Process != nil {
+		dc := *d
+		dc.Process = j.Process
+		d = &dc
+	}
+	ch := j.Chapter
+	var details *Details
+	if j.Format != "" && j.Format != "images" || d.Process != nil {
+		var err error
+		if details, err = r.mangaDetails(ctx, ch.Manga); err != nil {
+			return err
+		}
+	}
+	chapters, title := []Chapter{ch}, ""
+	if len(j.Bundle) > 0 {
+		chapters = j.Bundle
+		title = VolumeGroup{Volume: ch.Volume, Chapters: j.Bundle}.Title(details)
+	}
+	switch j.Format {
+	case "", "images":
+		if len(j.Bundle) > 0 {
+			return fmt.Errorf("volume %s: bundles need a cbz, epub or pdf format", FormatNumber(ch.Volume))
+		}
+		_, err := d.DownloadProcessed(ctx, ch, details, j.Path)
+		return err
+	case "cbz":
+		if len(j.Bundle) > 0 {
+			return d.DownloadVolumeCBZ(ctx, VolumeGroup{Volume: ch.Volume, Chapters: j.Bundle}, details, j.Path)
+		}
+		return d.DownloadCBZ(ctx, ch, details, j.Path)
+	case "epub":
+		opts := EPUBOptions{Title: title}
+		if j.Device != "" {
+			dp, ok := LookupDevice(j.Device)
+			if !ok {
+				return fmt.Errorf("unknown device %q", j.Device)
+			}
+			opts.Device = &dp
+		}
+		return d.DownloadEPUB(ctx, chapters, details, j.Path, opts)
+	case "pdf":
+		return d.DownloadPDF(ctx, chapters, details, j.Path, PDFOptions{Title: title})
+	}
+	return fmt.Errorf("unknown format %q", j.Format)
+}
+
+// mangaDetails fetches the details of manga once per runner.
+func (r *QueueRunner) mangaDetails(ctx context.Context, manga MangaRef) (*Details, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d, ok := r.details[manga.ID]; ok {
+		return d, nil
+	}
+	d, err := r.Downloader.Client.Details(ctx, manga)
+	if err != nil {
+		return nil, err
+	}
+	if r.details == nil {
+		r.details = make(map[string]*Details)
+	}
+	r.details[manga.ID] = d
+	return d, nil
+}
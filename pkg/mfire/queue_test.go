@@ -0,0 +1,318 @@
+package mfire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := q.Add(
+		Job{Chapter: Chapter{ID: "a"}, Path: "a"},
+		Job{Chapter: Chapter{ID: "b"}, Path: "b", Priority: 5},
+		Job{Chapter: Chapter{ID: "c"}, Path: "c", Format: "cbz"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[0].ID != 1 || added[2].ID != 3 || added[0].Format != "images" || added[0].State != JobQueued {
+		t.Fatalf("added = %+v", added)
+	}
+
+	order := func() []string {
+		t.Helper()
+		q, err := OpenQueue(path) // reopen: state lives in the file
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := q.Jobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, j := range jobs {
+			out = append(out, j.Chapter.ID+":"+string(j.State))
+		}
+		return out
+	}
+	if got, want := order(), []string{"b:queued", "a:queued", "c:queued"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+
+	if err := q.Pause(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Cancel(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetPriority(3, 9); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(), []string{"c:canceled", "b:queued", "a:paused"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	if err := q.Pause(2, 3); err == nil || !strings.Contains(err.Error(), "job 3 is canceled") {
+		t.Errorf("pausing a canceled job: %v", err)
+	}
+	if got := order()[1]; got != "b:queued" {
+		t.Errorf("failed Pause changed job 2: %s", got)
+	}
+	if err := q.Resume(99); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("resume 99: %v, want ErrJobNotFound", err)
+	}
+	if err := q.Resume(1); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := q.Prune(); err != nil || n != 1 {
+		t.Errorf("prune = %d, %v; want 1", n, err)
+	}
+	if got, want := order(), []string{"b:queued", "a:queued"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestQueueRunner(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, gradient(20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		readers = make(map[string]int)
+	)
+	// chapter "ok" has two pages, "gone" is 404, "flaky" fails its first
+	// request and "slow" never finishes its page
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		respond := func(code int, body []byte) (*http.Response, error) {
+			return &http.Response{StatusCode: code, Status: fmt.Sprint(code), Header: http.Header{},
+				Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+		}
+		if req.URL.Host == "img.test" {
+			if strings.HasPrefix(req.URL.Path, "/slow/") {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+			return respond(200, img.Bytes())
+		}
+		id := strings.TrimPrefix(req.URL.Path, "/ajax/read/chapter/")
+		mu.Lock()
+		readers[id]++
+		n := readers[id]
+		mu.Unlock()
+		switch {
+		case id == "gone":
+			return respond(404, nil)
+		case id == "flaky" && n == 1:
+			return respond(503, nil)
+		}
+		body := fmt.Sprintf(`{"status":200,"result":{"images":[["https://img.test/%[1]s/1.png",1,0],["https://img.test/%[1]s/2.png",1,0]]}}`, id)
+		return respond(200, []byte(body))
+	})
+
+	dir := t.TempDir()
+	q, err := OpenQueue(filepath.Join(dir, "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []Job
+	for _, id := range []string{"ok", "gone", "flaky", "slow"} {
+		jobs = append(jobs, Job{Chapter: Chapter{ID: id}, Path: filepath.Join(dir, id)})
+	}
+	if _, err := q.Add(jobs...); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDownloader(NewClient(WithTransport(rt), WithHostLimit(2)))
+	d.Retries = -1
+	var states []string
+	r := &QueueRunner{Queue: q, Downloader: d, Jobs: 2, RetryDelay: 10 * time.Millisecond, Poll: 10 * time.Millisecond}
+	r.OnChange = func(j Job) {
+		states = append(states, j.Chapter.ID+":"+string(j.State))
+		if j.Chapter.ID == "slow" && j.State == JobRunning {
+			// paused from "another process" while downloading
+			go q.Pause(j.ID)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	final, err := q.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]Job)
+	for _, j := range final {
+		got[j.Chapter.ID] = j
+	}
+	want := map[string]JobState{"ok": JobDone, "gone": JobFailed, "flaky": JobDone, "slow": JobPaused}
+	for id, state := range want {
+		if got[id].State != state {
+			t.Errorf("%s: state %s (%s), want %s", id, got[id].State, got[id].Error, state)
+		}
+	}
+	if got["gone"].Attempts != 1 || !strings.Contains(got["gone"].Error, "404") {
+		t.Errorf("gone: %d attempts, error %q; want one attempt failing with 404", got["gone"].Attempts, got["gone"].Error)
+	}
+	if got["flaky"].Attempts != 1 || readers["flaky"] != 2 {
+		t.Errorf("flaky: %d attempts, %d requests", got["flaky"].Attempts, readers["flaky"])
+	}
+	if !strings.Contains(strings.Join(states, " "), "flaky:queued") {
+		t.Errorf("states %v: flaky was not scheduled for a retry", states)
+	}
+}
+
+func TestQueueRunnerHostLimit(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, gradient(20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]int)
+		peak     = make(map[string]int)
+		readers  = make(map[string]int)
+	)
+	// every chapter has four pages; "blocked" is refused once with a 403
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		host := req.URL.Host
+		mu.Lock()
+		inFlight[host]++
+		if inFlight[host] > peak[host] {
+			peak[host] = inFlight[host]
+		}
+		id := strings.TrimPrefix(req.URL.Path, "/ajax/read/chapter/")
+		readers[id]++
+		n := readers[id]
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight[host]--
+			mu.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond)
+		respond := func(code int, body []byte) (*http.Response, error) {
+			return &http.Response{StatusCode: code, Status: fmt.Sprint(code), Header: http.Header{},
+				Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+		}
+		if host == "img.test" {
+			return respond(200, img.Bytes())
+		}
+		if id == "blocked" && n == 1 {
+			return respond(403, nil)
+		}
+		body := fmt.Sprintf(`{"status":200,"result":{"images":[["https://img.test/%[1]s/1.png",1,0],`+
+			`["https://img.test/%[1]s/2.png",1,0],["https://img.test/%[1]s/3.png",1,0],["https://img.test/%[1]s/4.png",1,0]]}}`, id)
+		return respond(200, []byte(body))
+	})
+
+	dir := t.TempDir()
+	q, err := OpenQueue(filepath.Join(dir, "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []Job
+	for _, id := range []string{"a", "b", "c", "blocked"} {
+		jobs = append(jobs, Job{Chapter: Chapter{ID: id}, Path: filepath.Join(dir, id)})
+	}
+	if _, err := q.Add(jobs...); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDownloader(NewClient(WithTransport(rt), WithHostLimit(2)))
+	d.Workers = 4
+	d.Retries = -1
+	r := &QueueRunner{Queue: q, Downloader: d, Jobs: 4, RetryDelay: 10 * time.Millisecond, Poll: 10 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	final, err := q.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range final {
+		if j.State != JobDone {
+			t.Errorf("%s: state %s (%s), want done", j.Chapter.ID, j.State, j.Error)
+		}
+	}
+	if readers["blocked"] != 2 {
+		t.Errorf("blocked chapter requested %d times, want a retry after the 403", readers["blocked"])
+	}
+	for _, host := range []string{"mangafire.to", "img.test"} {
+		if peak[host] != 2 {
+			t.Errorf("%s: at most %d requests in flight, want the limit of 2", host, peak[host])
+		}
+	}
+}
+
+// TestQueueRunnerCancel checks no job is left running when ctx ends while
+// results of interrupted jobs are already waiting.
+func TestQueueRunnerCancel(t *testing.T) {
+	// every chapter hangs until its download is cancelled
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+	d := NewDownloader(NewClient(WithTransport(rt)))
+	d.Retries = -1
+	// Run's select sees the results and ctx.Done at once, so repeat to
+	// give it every chance of picking a result first
+	for round := 0; round < 10; round++ {
+		dir := t.TempDir()
+		q, err := OpenQueue(filepath.Join(dir, "queue.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var jobs []Job
+		for _, id := range []string{"a", "b", "c"} {
+			jobs = append(jobs, Job{Chapter: Chapter{ID: id}, Path: filepath.Join(dir, id)})
+		}
+		if _, err := q.Add(jobs...); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &QueueRunner{Queue: q, Downloader: d, Jobs: 3, Poll: 10 * time.Millisecond}
+		r.OnChange = func(j Job) {
+			if j.Chapter.ID == "c" && j.State == JobRunning {
+				// the jobs already started end while Run is busy here
+				cancel()
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+		if err := r.Run(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run = %v, want context.Canceled", err)
+		}
+		final, err := q.Jobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, j := range final {
+			if j.State != JobQueued || j.Attempts != 0 {
+				t.Fatalf("round %d: %s is %s after %d attempts (%s), want queued", round, j.Chapter.ID, j.State, j.Attempts, j.Error)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package mfire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ajaxResponse is the envelope of the site's ajax endpoints.
+type ajaxResponse struct {
+	Status   int             `json:"status"`
+	Result   json.RawMessage `json:"result"`
+	Messages []string        `json:"messages"`
+}
+
+// decodeAjax unwraps an ajax envelope into result.
+func decodeAjax(body []byte, result interface{}) error {
+	var env ajaxResponse
+	if err := json.Unmarshal(body, &env); err != nil {
+		return fmt.Errorf("decode ajax response: %w", err)
+	}
+	if env.Status != 0 && env.Status != 200 {
+		return fmt.Errorf("ajax status %d: %s", env.Status, strings.Join(env.Messages, "; "))
+	}
+	return json.Unmarshal(env.Result, result)
+}
+
+// QuickSearch returns the site's type-ahead suggestions for query, as shown
+// under the search box. It is much cheaper than Search: one small ajax
+// request instead of the full filter page. Suggestions carry the status and
+// the latest chapter/volume numbers (without language) when the site shows
+// them.
+func (c *Client) QuickSearch(ctx context.Context, query string) ([]Manga, error) {
+	q := strings.TrimSpace(query)
+	if q == "" {
+		return []Manga{}, nil
+	}
+	vrf, err := GenerateVrf(q)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.fetchBody(ctx, quickSearchURL(q, vrf), "https://mangafire.to/home")
+	var se *StatusError
+	if errors.As(err, &se) && se.Code == http.StatusForbidden {
+		// same fallback as Search: the browser's own search box hits this
+		// endpoint, so its vrf can be sniffed directly
+		if bvrf, pctx, berr := c.browserVrf(ctx, q); berr == nil && bvrf != "" {
+			body, err = c.fetchBody(pctx, quickSearchURL(q, bvrf), "https://mangafire.to/home")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.parser.QuickSearch(body)
+}
+
+func quickSearchURL(q, vrf string) string {
+	return "https://mangafire.to/ajax/manga/search?keyword=" + url.QueryEscape(q) + "&vrf=" + url.QueryEscape(vrf)
+}
+
+// QuickSearch parses the JSON response of the ajax search endpoint.
+func (p *Parser) QuickSearch(body []byte) ([]Manga, error) {
+	var result struct {
+		HTML string `json:"html"`
+	}
+	if err := decodeAjax(body, &result); err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(result.HTML))
+	if err != nil {
+		return nil, err
+	}
+	d := newDiag("quick search")
+	out := []Manga{}
+	p.find(d, doc.Selection, "suggest").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		m := newManga(p.find(d, s, "suggest.title").First().Text(), href, imgSrc(p.find(d, s, "suggest.cover")))
+		p.find(d, s, "suggest.meta").Each(func(i int, span *goquery.Selection) {
+			text := cleanText(span.Text())
+			if lc, ok := parseLatestLabel(text); ok {
+				m.Latest = append(m.Latest, lc)
+			} else if i == 0 {
+				m.Status = text
+			}
+		})
+		out = append(out, m)
+	})
+	if len(out) > 0 {
+		d.require("suggest.title")
+	} else if strings.TrimSpace(doc.Text()) != "" && p.find(d, doc.Selection, "cards.empty").Length() == 0 {
+		d.require("suggest")
+	}
+	return out, d.err()
+}
+
+// parseLatestLabel parses labels such as "Chap 1100" or "Vol 107".
+func parseLatestLabel(s string) (LatestChapter, bool) {
+	label, num, ok := strings.Cut(s, " ")
+	if !ok {
+		return LatestChapter{}, false
+	}
+	var kind string
+	switch strings.ToLower(strings.TrimSuffix(label, ".")) {
+	case "chap", "chapter", "ch":
+		kind = "chapter"
+	case "vol", "volume":
+		kind = "volume"
+	default:
+		return LatestChapter{}, false
+	}
+	if num = strings.TrimSpace(num); num == "" {
+		return LatestChapter{}, false
+	}
+	return LatestChapter{Kind: kind, Number: num}, true
+}
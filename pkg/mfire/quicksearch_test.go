@@ -0,0 +1,63 @@
+package mfire
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParserQuickSearch(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "quicksearch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewParser(nil).QuickSearch(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 {
+		t.Fatal("no suggestions")
+	}
+	for _, m := range got {
+		checkManga(t, "quicksearch.json", m)
+		if m.Status == "" {
+			t.Errorf("%s: no status", m.Title)
+		}
+	}
+
+	// the fields of one suggestion, exactly
+	got, err = NewParser(nil).QuickSearch([]byte(`{"status":200,"result":{"count":1,"html":"` +
+		`<a href=\"/manga/one-piecee.dkw\" class=\"unit\"><div class=\"poster\"><div><img src=\"/assets/no-image.png\"></div></div>` +
+		`<div class=\"info\"><h6>One Piece</h6><div><span>Releasing</span><span><b>Chap 1100</b></span><span><b>Vol 107</b></span></div></div></a>"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Manga{{ID: "dkw", Slug: "one-piecee", Title: "One Piece", Status: "Releasing",
+		Url:    "https://mangafire.to/manga/one-piecee.dkw",
+		Cover:  "https://mangafire.to/assets/no-image.png",
+		Latest: []LatestChapter{{Kind: "chapter", Number: "1100"}, {Kind: "volume", Number: "107"}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParserQuickSearchEmptyAndErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{"no suggestions", `{"status":200,"result":{"count":0,"html":""}}`, 0, false},
+		{"error status", `{"status":403,"messages":["forbidden"]}`, 0, true},
+		{"not json", `<html>challenge</html>`, 0, true},
+		{"layout changed", `{"status":200,"result":{"html":"<ul><li><a href=\"/manga/x.y\">X</a></li></ul>"}}`, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(nil).QuickSearch([]byte(tt.body))
+		if (err != nil) != tt.wantErr || len(got) != tt.want {
+			t.Errorf("%s: got %d results, err %v", tt.name, len(got), err)
+		}
+	}
+}
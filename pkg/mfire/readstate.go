@@ -0,0 +1,127 @@
+package mfire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReadState records which chapters and volumes of each manga were read,
+// by number, whatever their language, so downloads can skip them (see
+// Selection.Read). It is kept in a JSON file.
+type ReadState struct {
+	Manga   map[string]*ReadManga `json:"manga"`
+	Updated time.Time             `json:"updated"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// ReadManga is the read chapters and volumes of one manga, in order.
+type ReadManga struct {
+	Chapters []float64 `json:"chapters,omitempty"`
+	Volumes  []float64 `json:"volumes,omitempty"`
+}
+
+// LoadReadState reads the read state kept in path. A missing file is an
+// empty state, created by the first Save.
+func LoadReadState(path string) (*ReadState, error) {
+	s := &ReadState{Manga: make(map[string]*ReadManga), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("load read state %s: %w", path, err)
+	}
+	if s.Manga == nil {
+		s.Manga = make(map[string]*ReadManga)
+	}
+	return s, nil
+}
+
+// Path returns the file the state is kept in.
+func (s *ReadState) Path() string { return s.path }
+
+// numbers returns the list ch is recorded in, creating the manga's entry
+// when create is set.
+func (s *ReadState) numbers(ch Chapter, create bool) *[]float64 {
+	m := s.Manga[ch.Manga.ID]
+	if m == nil {
+		if !create {
+			return nil
+		}
+		m = &ReadManga{}
+		s.Manga[ch.Manga.ID] = m
+	}
+	if ch.Kind == "volume" {
+		return &m.Volumes
+	}
+	return &m.Chapters
+}
+
+// IsRead reports whether ch is marked read.
+func (s *ReadState) IsRead(ch Chapter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.numbers(ch, false)
+	if list == nil {
+		return false
+	}
+	i := sort.SearchFloat64s(*list, ch.Number)
+	return i < len(*list) && (*list)[i] == ch.Number
+}
+
+// MarkRead marks chapters read.
+func (s *ReadState) MarkRead(chapters ...Chapter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range chapters {
+		list := s.numbers(ch, true)
+		i := sort.SearchFloat64s(*list, ch.Number)
+		if i < len(*list) && (*list)[i] == ch.Number {
+			continue
+		}
+		*list = append(*list, 0)
+		copy((*list)[i+1:], (*list)[i:])
+		(*list)[i] = ch.Number
+	}
+}
+
+// MarkUnread removes chapters' read marks.
+func (s *ReadState) MarkUnread(chapters ...Chapter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range chapters {
+		list := s.numbers(ch, false)
+		if list == nil {
+			continue
+		}
+		i := sort.SearchFloat64s(*list, ch.Number)
+		if i < len(*list) && (*list)[i] == ch.Number {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+		}
+		if m := s.Manga[ch.Manga.ID]; len(m.Chapters) == 0 && len(m.Volumes) == 0 {
+			delete(s.Manga, ch.Manga.ID)
+		}
+	}
+}
+
+// Save writes the state to its file atomically.
+func (s *ReadState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,64 @@
+package mfire
+
+import (
+	"context"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// HomeSections returns every discovery list on the home page: the trending
+// carousel, the most-viewed day/week/month tabs, recently updated titles
+// with their latest chapter per language, and new releases.
+func (c *Client) HomeSections(ctx context.Context) (*HomeSections, error) {
+	doc, err := c.fetchDocument(ctx, "https://mangafire.to/home")
+	if err != nil {
+		return nil, err
+	}
+	return c.parser.HomeSections(doc)
+}
+
+// HomeSections parses the sections of the home page. Every section is
+// required; a missing one yields a *LayoutError alongside whatever could be
+// parsed.
+func (p *Parser) HomeSections(doc *goquery.Document) (*HomeSections, error) {
+	d := newDiag("home")
+	hs := &HomeSections{
+		Trending:    p.units(d, doc.Selection, "trending", "trending"),
+		NewReleases: p.units(d, doc.Selection, "new-releases", "new-releases"),
+	}
+
+	p.find(d, doc.Selection, "most-viewed").Each(func(_ int, tab *goquery.Selection) {
+		list := p.units(d, tab, "most-viewed.item", "most-viewed")
+		switch tab.AttrOr("data-name", "") {
+		case "day":
+			hs.MostViewed.Day = list
+		case "week":
+			hs.MostViewed.Week = list
+		case "month":
+			hs.MostViewed.Month = list
+		}
+	})
+
+	if updated := p.find(d, doc.Selection, "updated"); updated.Length() > 0 {
+		hs.RecentlyUpdated = p.cards(d, updated, 0)
+	}
+
+	d.require("trending", "most-viewed", "updated", "new-releases")
+	return hs, d.err()
+}
+
+// units parses a list of simple link+cover items. items selects them;
+// prefix.link, prefix.title and prefix.cover are looked up inside each.
+func (p *Parser) units(d *diag, root *goquery.Selection, items, prefix string) []Manga {
+	var out []Manga
+	p.find(d, root, items).Each(func(_ int, s *goquery.Selection) {
+		link := p.find(d, s, prefix+".link").First()
+		href, _ := link.Attr("href")
+		title := p.find(d, s, prefix+".title").First().Text()
+		out = append(out, newManga(title, href, imgSrc(p.find(d, s, prefix+".cover"))))
+	})
+	if len(out) > 0 {
+		d.require(prefix+".link", prefix+".title")
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package mfire
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParserHomeSections(t *testing.T) {
+	hs, err := NewParser(nil).HomeSections(loadFixture(t, "home.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  []Manga
+	}{
+		{"trending", hs.Trending},
+		{"most viewed day", hs.MostViewed.Day},
+		{"most viewed week", hs.MostViewed.Week},
+		{"most viewed month", hs.MostViewed.Month},
+		{"recently updated", hs.RecentlyUpdated},
+		{"new releases", hs.NewReleases},
+	}
+	for _, tt := range tests {
+		if len(tt.got) == 0 {
+			t.Errorf("%s: empty", tt.name)
+		}
+		for _, m := range tt.got {
+			checkManga(t, tt.name, m)
+		}
+	}
+	latest := 0
+	for _, m := range hs.RecentlyUpdated {
+		latest += len(m.Latest)
+	}
+	if latest == 0 {
+		t.Error("recently updated entries list no chapters")
+	}
+	// the latest chapter in every language the card shows is kept
+	languages := make(map[Language]bool)
+	for _, lc := range hs.RecentlyUpdated[0].Latest {
+		languages[lc.Language] = true
+	}
+	if len(languages) < 2 {
+		t.Errorf("first recently updated entry keeps languages %v, want several", languages)
+	}
+}
+
+func TestParserHomeSectionsLayoutChanged(t *testing.T) {
+	_, err := NewParser(nil).HomeSections(loadFixture(t, "home_redesign.html"))
+	var le *LayoutError
+	if !errors.As(err, &le) {
+		t.Fatalf("err = %v, want *LayoutError", err)
+	}
+	if len(le.Missing) != 4 {
+		t.Errorf("missing = %v, want all four sections", le.Missing)
+	}
+}
@@ -0,0 +1,203 @@
+package mfire
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrBadRange is returned by ParseRanges for a malformed range expression.
+var ErrBadRange = errors.New("mfire: bad chapter range")
+
+// ChapterRange is an inclusive range of chapter (or volume) numbers. An
+// open end is infinite.
+type ChapterRange struct {
+	From, To float64
+}
+
+// Contains reports whether n is within r.
+func (r ChapterRange) Contains(n float64) bool {
+	return n >= r.From && n <= r.To
+}
+
+func (r ChapterRange) String() string {
+	switch {
+	case r.From == r.To:
+		return FormatNumber(r.From)
+	case math.IsInf(r.To, 1):
+		return FormatNumber(r.From) + "-"
+	case math.IsInf(r.From, -1):
+		return "-" + FormatNumber(r.To)
+	}
+	return FormatNumber(r.From) + "-" + FormatNumber(r.To)
+}
+
+// ParseRanges parses a comma-separated list of numbers and ranges, such as
+// "1-10,15,20-": "20-" is chapter 20 onward and "-5" everything up to
+// chapter 5. Ranges include fractional chapters, so "1-2" has 1.5.
+func ParseRanges(s string) ([]ChapterRange, error) {
+	var ranges []ChapterRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		r := ChapterRange{From: math.Inf(-1), To: math.Inf(1)}
+		var err error
+		if from = strings.TrimSpace(from); from != "" {
+			if r.From, err = strconv.ParseFloat(from, 64); err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrBadRange, part)
+			}
+		}
+		if to = strings.TrimSpace(to); to != "" {
+			if r.To, err = strconv.ParseFloat(to, 64); err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrBadRange, part)
+			}
+		}
+		if from == "" && to == "" || r.From > r.To || math.IsNaN(r.From) || math.IsNaN(r.To) {
+			return nil, fmt.Errorf("%w: %q", ErrBadRange, part)
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrBadRange, s)
+	}
+	return ranges, nil
+}
+
+// inRanges reports whether n is in any of ranges; no ranges means all.
+func inRanges(ranges []ChapterRange, n float64) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Contains(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selection picks chapters out of a chapter list. The zero Selection
+// picks them all.
+type Selection struct {
+	// Ranges limits the chapter numbers.
+	Ranges []ChapterRange
+	// Volumes limits the volumes, by the volume numbers parsed from the
+	// chapter titles.
+	Volumes []ChapterRange
+	// Latest, when positive, keeps only the newest Latest chapters left
+	// after the other filters.
+	Latest int
+	// Read, when set, leaves out the chapters marked read in it.
+	Read *ReadState
+}
+
+// Apply returns the chapters s picks, oldest first, so they download in
+// reading order. chapters may be in any order, such as the site's newest
+// first.
+func (s Selection) Apply(chapters []Chapter) []Chapter {
+	var out []Chapter
+	for _, ch := range chapters {
+		if !inRanges(s.Ranges, ch.Number) || !inRanges(s.Volumes, ch.Volume) {
+			continue
+		}
+		if s.Read != nil && s.Read.IsRead(ch) {
+			continue
+		}
+		out = append(out, ch)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	if s.Latest > 0 && len(out) > s.Latest {
+		out = out[len(out)-s.Latest:]
+	}
+	return out
+}
+
+// VolumeGroup is the chapters of one volume, bundled into one file by
+// Downloader.DownloadVolumeCBZ, DownloadEPUB or DownloadPDF.
+type VolumeGroup struct {
+	// Volume is the volume number, 0 for chapters not known to belong to
+	// a volume.
+	Volume float64
+	// Chapters are in reading order. A volume the site offers as a whole
+	// is a single chapter of kind "volume".
+	Chapters []Chapter
+}
+
+// Chapter describes the whole volume, for naming and metadata: a chapter
+// of kind "volume" numbered after it, titled "Vol. N", dated like its
+// newest chapter.
+func (g VolumeGroup) Chapter() Chapter {
+	if len(g.Chapters) == 1 && g.Chapters[0].Kind == "volume" {
+		return g.Chapters[0]
+	}
+	ch := Chapter{Kind: "volume", Number: g.Volume, Volume: g.Volume, Title: "Vol. " + FormatNumber(g.Volume)}
+	for _, c := range g.Chapters {
+		ch.Manga, ch.Language = c.Manga, c.Language
+		if c.Date.After(ch.Date) {
+			ch.Date = c.Date
+		}
+	}
+	return ch
+}
+
+// Title is the book title of the volume bundled into an EPUB or PDF,
+// such as "One Piece - Vol. 3"; details may be nil.
+func (g VolumeGroup) Title(details *Details) string {
+	return exportTitle(details, []ExportChapter{{Chapter: g.Chapter()}})
+}
+
+// Bundle picks chapters like Apply and groups them by volume, in volume
+// order. volumes are the volumes the site offers as a whole, as listed by
+// Client.VolumeList. One replaces the chapters of its volume only when s
+// picks every chapter of that volume and the volume isn't marked read;
+// otherwise just the picked chapters are bundled. A volume s.Volumes
+// selects is included even without any chapter known to belong to it.
+func (s Selection) Bundle(chapters, volumes []Chapter) []VolumeGroup {
+	byVolume := make(map[float64]*VolumeGroup)
+	var groups []*VolumeGroup
+	group := func(n float64) *VolumeGroup {
+		g, ok := byVolume[n]
+		if !ok {
+			g = &VolumeGroup{Volume: n}
+			byVolume[n] = g
+			groups = append(groups, g)
+		}
+		return g
+	}
+	whole := make(map[float64]Chapter)
+	for _, v := range volumes {
+		if s.Read != nil && s.Read.IsRead(v) {
+			continue
+		}
+		whole[v.Number] = v
+		if len(s.Volumes) > 0 && inRanges(s.Volumes, v.Number) {
+			group(v.Number)
+		}
+	}
+	listed := make(map[float64]int)
+	for _, ch := range chapters {
+		listed[ch.Volume]++
+	}
+	for _, ch := range s.Apply(chapters) {
+		g := group(ch.Volume)
+		g.Chapters = append(g.Chapters, ch)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Volume < groups[j].Volume })
+	out := make([]VolumeGroup, len(groups))
+	for i, g := range groups {
+		if v, ok := whole[g.Volume]; ok && g.Volume != 0 && len(g.Chapters) == listed[g.Volume] {
+			g.Chapters = []Chapter{v}
+		}
+		out[i] = *g
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package mfire
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1-10,15,20-", "1-10 15 20-"},
+		{" -5 , 7.5 ", "-5 7.5"},
+		{"3-3,", "3"},
+	}
+	for _, tt := range tests {
+		ranges, err := ParseRanges(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if got := strings.Trim(fmt.Sprint(ranges), "[]"); got != tt.want {
+			t.Errorf("%q = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", ",", "-", "a-3", "10-1", "1-2-3", "NaN"} {
+		if _, err := ParseRanges(bad); !errors.Is(err, ErrBadRange) {
+			t.Errorf("%q: err = %v, want ErrBadRange", bad, err)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	manga := MangaRef{ID: "dkw", Slug: "op"}
+	var list []Chapter // newest first, like the site
+	for n := 12.0; n >= 1; n-- {
+		list = append(list, Chapter{ID: FormatNumber(n), Manga: manga, Number: n, Volume: float64(int(n-1)/4 + 1)})
+	}
+	list = append(list[:3], append([]Chapter{{ID: "9.5", Manga: manga, Number: 9.5, Volume: 3}}, list[3:]...)...)
+	list = append(list, Chapter{ID: "0", Manga: manga, Number: 0}) // no volume known
+
+	read, err := LoadReadState(filepath.Join(t.TempDir(), "read.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read.MarkRead(list[1], list[5]) // 11 and 8
+	numbers := func(chapters []Chapter) string {
+		var s []string
+		for _, ch := range chapters {
+			s = append(s, FormatNumber(ch.Number))
+		}
+		return strings.Join(s, " ")
+	}
+	ranges := func(s string) []ChapterRange {
+		r, err := ParseRanges(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		name string
+		sel  Selection
+		want string
+	}{
+		{"all", Selection{}, "0 1 2 3 4 5 6 7 8 9 9.5 10 11 12"},
+		{"ranges", Selection{Ranges: ranges("2-3,9-10,12-")}, "2 3 9 9.5 10 12"},
+		{"volume", Selection{Volumes: ranges("2")}, "5 6 7 8"},
+		{"latest", Selection{Latest: 3}, "10 11 12"},
+		{"unread", Selection{Read: read, Ranges: ranges("7-")}, "7 9 9.5 10 12"},
+		{"latest unread", Selection{Read: read, Latest: 2}, "10 12"},
+	}
+	for _, tt := range tests {
+		if got := numbers(tt.sel.Apply(list)); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// the site's volume 2 replaces its chapters only when all of them are
+	// picked; volume 4 has none listed
+	volumes := []Chapter{
+		{ID: "v4", Manga: manga, Kind: "volume", Number: 4, Volume: 4},
+		{ID: "v2", Manga: manga, Kind: "volume", Number: 2, Volume: 2},
+	}
+	bundles := []struct {
+		name string
+		sel  Selection
+		want string
+	}{
+		{"whole", Selection{Volumes: ranges("1-")}, "1:1 2 3 4 2:2 3:9 9.5 10 11 12 4:4"},
+		{"read chapter", Selection{Volumes: ranges("1-"), Read: read}, "1:1 2 3 4 2:5 6 7 3:9 9.5 10 12 4:4"},
+		{"some chapters", Selection{Ranges: ranges("2-6")}, "1:2 3 4 2:5 6"},
+		{"all chapters", Selection{Ranges: ranges("5-8")}, "2:2"},
+	}
+	for _, tt := range bundles {
+		groups := tt.sel.Bundle(list, volumes)
+		var got []string
+		for _, g := range groups {
+			got = append(got, FormatNumber(g.Volume)+":"+numbers(g.Chapters))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: bundle = %s, want %s", tt.name, strings.Join(got, " "), tt.want)
+		}
+	}
+	// a volume marked read is never bundled whole
+	readVolume, err := LoadReadState(filepath.Join(t.TempDir(), "volume.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readVolume.MarkRead(volumes[1])
+	if g := (Selection{Volumes: ranges("2"), Read: readVolume}).Bundle(list, volumes); len(g) != 1 || numbers(g[0].Chapters) != "5 6 7 8" {
+		t.Errorf("read volume 2 bundled as %+v", g)
+	}
+	groups := Selection{Volumes: ranges("1-")}.Bundle(list, volumes)
+	if ch := groups[0].Chapter(); ch.Kind != "volume" || ch.Number != 1 || ch.Title != "Vol. 1" || ch.Manga != manga {
+		t.Errorf("volume 1 described as %+v", ch)
+	}
+	if ch := groups[1].Chapter(); ch.ID != "v2" {
+		t.Errorf("site volume described as %+v", ch)
+	}
+	if title := groups[0].Title(&Details{Title: "One Piece"}); title != "One Piece - Vol. 1" {
+		t.Errorf("title = %q", title)
+	}
+}
+
+func TestReadState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "read.json")
+	s, err := LoadReadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, other := MangaRef{ID: "dkw"}, MangaRef{ID: "xyz"}
+	s.MarkRead(Chapter{Manga: op, Number: 3}, Chapter{Manga: op, Number: 1}, Chapter{Manga: op, Number: 3},
+		Chapter{Manga: op, Kind: "volume", Number: 1}, Chapter{Manga: other, Number: 7})
+	s.MarkUnread(Chapter{Manga: other, Number: 7}, Chapter{Manga: op, Number: 5})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = LoadReadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ch   Chapter
+		want bool
+	}{
+		{Chapter{Manga: op, Number: 1, Language: SpanishLatAm}, true},
+		{Chapter{Manga: op, Number: 2}, false},
+		{Chapter{Manga: op, Number: 3}, true},
+		{Chapter{Manga: op, Kind: "volume", Number: 1}, true},
+		{Chapter{Manga: op, Kind: "volume", Number: 3}, false},
+		{Chapter{Manga: other, Number: 7}, false},
+	}
+	for _, tt := range tests {
+		if got := s.IsRead(tt.ch); got != tt.want {
+			t.Errorf("IsRead(%s %s %s) = %v", tt.ch.Manga.ID, tt.ch.Kind, FormatNumber(tt.ch.Number), got)
+		}
+	}
+	if m := s.Manga["dkw"]; len(m.Chapters) != 2 || len(s.Manga) != 1 {
+		t.Errorf("state = %+v", s.Manga)
+	}
+}
@@ -0,0 +1,131 @@
+package mfire
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// sessionState tracks whether the Client has a usable site session, i.e.
+// whether the preflight request to /filter has set the cookies the server
+// expects on searches.
+type sessionState struct {
+	mu         sync.Mutex
+	ready      bool
+	hadCookies bool
+	expires    time.Time // earliest expiry among the preflight cookies
+}
+
+var siteURL = &url.URL{Scheme: "https", Host: "mangafire.to", Path: "/"}
+
+// ensureSession performs the preflight request once and again only when the
+// session has gone stale (its cookies expired or vanished from the jar). It
+// reports whether a preflight was made.
+func (c *Client) ensureSession(ctx context.Context) (bool, error) {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	if c.sessionValidLocked() {
+		return false, nil
+	}
+	return true, c.preflightLocked(ctx)
+}
+
+// refreshSession forces a new preflight, e.g. after a 403 suggests the
+// server no longer recognises the session.
+func (c *Client) refreshSession(ctx context.Context) error {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	c.session.ready = false
+	return c.preflightLocked(ctx)
+}
+
+// ResetSession forgets the current session so the next search performs a
+// fresh preflight. Cookies already in the jar are kept.
+func (c *Client) ResetSession() {
+	c.session.mu.Lock()
+	c.session.ready = false
+	c.session.mu.Unlock()
+}
+
+func (c *Client) sessionValidLocked() bool {
+	s := &c.session
+	if !s.ready {
+		return false
+	}
+	if !s.expires.IsZero() && time.Now().After(s.expires) {
+		return false
+	}
+	if s.hadCookies && len(c.http.Jar.Cookies(siteURL)) == 0 {
+		return false
+	}
+	return true
+}
+
+// preflightLocked fetches the filter page to populate cookies and any
+// session state. Many clients (Kotatsu/Mihon) request /filter before
+// performing searches which sets cookies the server expects for subsequent
+// calls.
+func (c *Client) preflightLocked(ctx context.Context) error {
+	// the point is the Set-Cookie headers, which the response cache drops
+	req, err := c.newRequest(withoutCache(ctx), "https://mangafire.to/filter", "https://mangafire.to/")
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("session preflight: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("session preflight: bad status: %s", resp.Status)
+	}
+
+	s := &c.session
+	s.ready = true
+	s.expires = time.Time{}
+	s.hadCookies = len(resp.Cookies()) > 0 || len(c.http.Jar.Cookies(siteURL)) > 0
+	now := time.Now()
+	for _, ck := range resp.Cookies() {
+		var exp time.Time
+		switch {
+		case ck.MaxAge > 0:
+			exp = now.Add(time.Duration(ck.MaxAge) * time.Second)
+		case !ck.Expires.IsZero():
+			exp = ck.Expires
+		}
+		if !exp.IsZero() && (s.expires.IsZero() || exp.Before(s.expires)) {
+			s.expires = exp
+		}
+	}
+	return nil
+}
+
+// doSearchRequest performs a search request. A 403 on a session that wasn't
+// just established is retried once after a fresh preflight, since it
+// usually means the server has dropped the session. The refresh is
+// best-effort like the first preflight: its error is returned separately
+// and the search is retried regardless.
+func (c *Client) doSearchRequest(ctx context.Context, searchURL string, freshSession bool) (resp *http.Response, refreshErr, err error) {
+	req, err := c.newRequest(ctx, searchURL, "https://mangafire.to/filter")
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err = c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusForbidden || freshSession {
+		return resp, nil, nil
+	}
+	resp.Body.Close()
+	refreshErr = c.refreshSession(ctx)
+	req, err = c.newRequest(ctx, searchURL, "https://mangafire.to/filter")
+	if err != nil {
+		return nil, refreshErr, err
+	}
+	resp, err = c.http.Do(req)
+	return resp, refreshErr, err
+}
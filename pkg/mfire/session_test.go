@@ -0,0 +1,175 @@
+package mfire
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearchSession(t *testing.T) {
+	filter := readFixture(t, "filter.html")
+	tests := []struct {
+		name string
+		// status answers the nth request, "preflight" or "search"
+		status  func(kind string, n int) int
+		queries []string
+		want    string // requests made, in order
+		fail    bool
+		warned  bool // a preflight failed but the search didn't
+	}{
+		{
+			name: "blocked preflight",
+			status: func(kind string, n int) int {
+				if kind == "preflight" {
+					return 403
+				}
+				return 200
+			},
+			queries: []string{"one piece"},
+			want:    "preflight:403 search:200",
+			warned:  true,
+		},
+		{
+			name:    "session kept",
+			status:  func(string, int) int { return 200 },
+			queries: []string{"one piece", "naruto"},
+			want:    "preflight:200 search:200 search:200",
+		},
+		{
+			name: "refresh on 403",
+			status: func(kind string, n int) int {
+				if kind == "search" && n == 2 {
+					return 403
+				}
+				return 200
+			},
+			queries: []string{"one piece", "naruto"},
+			want:    "preflight:200 search:200 search:403 preflight:200 search:200",
+		},
+		{
+			name: "failed refresh",
+			status: func(kind string, n int) int {
+				switch {
+				case kind == "preflight" && n == 2:
+					return 503
+				case kind == "search" && n == 2:
+					return 403
+				}
+				return 200
+			},
+			queries: []string{"one piece", "naruto"},
+			want:    "preflight:200 search:200 search:403 preflight:503 search:200",
+			warned:  true,
+		},
+		{
+			name: "not found",
+			status: func(kind string, n int) int {
+				if kind == "preflight" {
+					return 500
+				}
+				return 404
+			},
+			queries: []string{"one piece"},
+			want:    "preflight:500 search:404",
+			fail:    true,
+		},
+	}
+	for _, tt := range tests {
+		var (
+			mu  sync.Mutex
+			log []string
+		)
+		counts := make(map[string]int)
+		rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			kind := "search"
+			if req.URL.Query().Get("keyword") == "" {
+				kind = "preflight"
+			}
+			if cc := req.Header.Get("Cache-Control"); cc != "" {
+				t.Errorf("%s: %s request sent Cache-Control: %s", tt.name, kind, cc)
+			}
+			mu.Lock()
+			counts[kind]++
+			code := tt.status(kind, counts[kind])
+			log = append(log, kind+":"+strconv.Itoa(code))
+			mu.Unlock()
+			header := http.Header{}
+			if kind == "preflight" && code == 200 {
+				header.Set("Set-Cookie", "session=1; Max-Age=3600; Path=/")
+			}
+			body := ""
+			if code == 200 && kind == "search" {
+				body = filter
+			}
+			return &http.Response{StatusCode: code, Status: http.StatusText(code), Header: header,
+				Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+		})
+		// the cache must not answer the refresh preflight
+		var warnings []error
+		c := NewClient(WithTransport(rt), WithCache(NewMemoryCache(0), time.Hour),
+			WithWarnings(func(err error) { warnings = append(warnings, err) }))
+		var err error
+		for _, q := range tt.queries {
+			var results []Manga
+			if results, err = c.Search(q, 5); err == nil && len(results) == 0 {
+				t.Errorf("%s: %q found nothing", tt.name, q)
+			}
+		}
+		if got := strings.Join(log, " "); got != tt.want {
+			t.Errorf("%s: requests %s, want %s", tt.name, got, tt.want)
+		}
+		var se *StatusError
+		if tt.fail && (!errors.As(err, &se) || se.Code != 404 || !strings.Contains(err.Error(), "preflight")) {
+			t.Errorf("%s: err = %v, want the 404 and the preflight error", tt.name, err)
+		}
+		if !tt.fail && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.warned != (len(warnings) == 1) || tt.warned && !strings.Contains(warnings[0].Error(), "preflight") {
+			t.Errorf("%s: warnings %v", tt.name, warnings)
+		}
+	}
+}
+
+// TestSearchBrowserRetryHostLimit checks the browser fallback's retry
+// doesn't wait on the host slot still held by the blocked response.
+func TestSearchBrowserRetryHostLimit(t *testing.T) {
+	defer func(f func(string, browserOptions, time.Duration) (string, browserInfo, error)) { vrfFromBrowser = f }(vrfFromBrowser)
+	vrfFromBrowser = func(string, browserOptions, time.Duration) (string, browserInfo, error) {
+		return "BROWSER", browserInfo{}, nil
+	}
+	filter := readFixture(t, "filter.html")
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		code, body := 200, ""
+		switch q := req.URL.Query(); {
+		case q.Get("vrf") == "BROWSER":
+			body = filter
+		case q.Get("keyword") != "":
+			code = 403
+		}
+		return &http.Response{StatusCode: code, Status: http.StatusText(code), Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})
+	c := NewClient(WithTransport(rt), WithHostLimit(1))
+	done := make(chan error, 1)
+	go func() {
+		results, err := c.Search("one piece", 5)
+		if err == nil && len(results) == 0 {
+			err = errors.New("found nothing")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("search hung on the host limit")
+	}
+}
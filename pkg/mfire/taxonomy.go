@@ -0,0 +1,125 @@
+package mfire
+
+import (
+	"context"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Genre is a genre accepted by the filter page. ID is what the site's
+// genre[] parameter expects; Name is the label it shows.
+type Genre struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// FilterValue is one choice of a filter control: the parameter value and
+// its label, e.g. {"one_shot", "One-Shot"}.
+type FilterValue struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+}
+
+// Taxonomy lists the values the filter page accepts, as offered by its form.
+type Taxonomy struct {
+	Genres    []Genre       `json:"genres"`
+	Types     []FilterValue `json:"types"`
+	Statuses  []FilterValue `json:"statuses"`
+	Languages []FilterValue `json:"languages"`
+	Years     []FilterValue `json:"years"`
+	Sorts     []FilterValue `json:"sorts"`
+}
+
+// Taxonomy returns the genres, types, statuses, languages, years and sort
+// keys offered by the /filter page. The first successful result is cached
+// on the Client; errors aren't, so a later call tries again. Each call
+// returns its own copy, which the caller may change.
+func (c *Client) Taxonomy(ctx context.Context) (*Taxonomy, error) {
+	c.taxonomyMu.Lock()
+	defer c.taxonomyMu.Unlock()
+	if c.taxonomy != nil {
+		return c.taxonomy.clone(), nil
+	}
+	doc, err := c.fetchDocument(ctx, "https://mangafire.to/filter")
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.parser.Taxonomy(doc)
+	if err != nil {
+		return nil, err
+	}
+	c.taxonomy = t
+	return t.clone(), nil
+}
+
+// clone copies t, slices included.
+func (t *Taxonomy) clone() *Taxonomy {
+	values := func(v []FilterValue) []FilterValue {
+		return append([]FilterValue(nil), v...)
+	}
+	return &Taxonomy{
+		Genres:    append([]Genre(nil), t.Genres...),
+		Types:     values(t.Types),
+		Statuses:  values(t.Statuses),
+		Languages: values(t.Languages),
+		Years:     values(t.Years),
+		Sorts:     values(t.Sorts),
+	}
+}
+
+// Taxonomy parses the filter form. Controls are told apart by their input
+// name ("genre[]", "sort", ...); a form without genres or sort keys yields a
+// *LayoutError.
+func (p *Parser) Taxonomy(doc *goquery.Document) (*Taxonomy, error) {
+	d := newDiag("filter")
+	t := &Taxonomy{}
+	form := p.find(d, doc.Selection, "filter-form")
+	p.find(d, form, "filter-form.option").Each(func(_ int, in *goquery.Selection) {
+		value := strings.TrimSpace(in.AttrOr("value", ""))
+		if value == "" {
+			return
+		}
+		v := FilterValue{Value: value, Name: optionLabel(form, in)}
+		switch strings.TrimSuffix(in.AttrOr("name", ""), "[]") {
+		case "genre":
+			t.Genres = append(t.Genres, Genre{ID: v.Value, Name: v.Name})
+		case "type":
+			t.Types = append(t.Types, v)
+		case "status":
+			t.Statuses = append(t.Statuses, v)
+		case "language":
+			t.Languages = append(t.Languages, v)
+		case "year":
+			t.Years = append(t.Years, v)
+		case "sort":
+			t.Sorts = append(t.Sorts, v)
+		}
+	})
+	d.count("filter-form.genre", len(t.Genres))
+	d.count("filter-form.sort", len(t.Sorts))
+	d.require("filter-form", "filter-form.genre", "filter-form.sort")
+	return t, d.err()
+}
+
+// optionLabel returns the text of the label for input in, falling back to
+// the label next to it and then to its value.
+func optionLabel(form, in *goquery.Selection) string {
+	if id := in.AttrOr("id", ""); id != "" {
+		var label string
+		form.Find("label").EachWithBreak(func(_ int, l *goquery.Selection) bool {
+			if l.AttrOr("for", "") == id {
+				label = cleanText(l.Text())
+				return false
+			}
+			return true
+		})
+		if label != "" {
+			return label
+		}
+	}
+	if label := cleanText(in.NextFiltered("label").Text()); label != "" {
+		return label
+	}
+	return in.AttrOr("value", "")
+}
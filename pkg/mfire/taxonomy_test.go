@@ -0,0 +1,93 @@
+package mfire
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParserTaxonomy(t *testing.T) {
+	tax, err := NewParser(nil).Taxonomy(loadFixture(t, "filter.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tax.Genres) == 0 {
+		t.Error("no genres")
+	}
+	for _, g := range tax.Genres {
+		if _, err := strconv.Atoi(g.ID); err != nil || g.Name == "" {
+			t.Errorf("bad genre %+v", g)
+		}
+	}
+	tests := []struct {
+		name string
+		got  []FilterValue
+		has  string // a value every version of the form offers
+	}{
+		{"types", tax.Types, "manga"},
+		{"statuses", tax.Statuses, "completed"},
+		{"languages", tax.Languages, "en"},
+		{"years", tax.Years, ""},
+		{"sorts", tax.Sorts, ""},
+	}
+	for _, tt := range tests {
+		found := tt.has == ""
+		for _, v := range tt.got {
+			if v.Value == "" || v.Name == "" {
+				t.Errorf("%s: bad value %+v", tt.name, v)
+			}
+			found = found || v.Value == tt.has
+		}
+		if len(tt.got) == 0 || !found {
+			t.Errorf("%s = %+v, want some including %q", tt.name, tt.got, tt.has)
+		}
+	}
+}
+
+func TestParserTaxonomyLayoutChanged(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<form id="filters"><input type="radio" name="sort" value="scores"></form>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewParser(nil).Taxonomy(doc)
+	var le *LayoutError
+	if !errors.As(err, &le) || len(le.Missing) != 1 || le.Missing[0] != "filter-form.genre" {
+		t.Fatalf("err = %v, want missing filter-form.genre", err)
+	}
+}
+
+func TestClientTaxonomy(t *testing.T) {
+	filter := readFixture(t, "filter.html")
+	requests := 0
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader(filter)), Request: req}, nil
+	})
+	c := NewClient(WithTransport(rt))
+	first, err := c.Taxonomy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := first.Genres[0].Name
+	// callers may edit their copy without touching the cache
+	first.Genres[0].Name = "edited"
+	first.Sorts = nil
+	second, err := c.Taxonomy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+	if second.Genres[0].Name != name || len(second.Sorts) == 0 {
+		t.Errorf("cached taxonomy changed: %+v", second)
+	}
+}
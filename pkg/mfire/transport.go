@@ -0,0 +1,301 @@
+package mfire
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+type headerOrderCtxKey struct{}
+
+// withHeaderOrder asks the default transport to send the request's headers
+// in the given order.
+func withHeaderOrder(ctx context.Context, order []string) context.Context {
+	return context.WithValue(ctx, headerOrderCtxKey{}, order)
+}
+
+func headerOrderFromContext(ctx context.Context) []string {
+	order, _ := ctx.Value(headerOrderCtxKey{}).([]string)
+	return order
+}
+
+// orderHeader carries a request's header order from orderedTransport to the
+// orderedConn writing it, which strips it before anything is sent.
+const orderHeader = "X-Mfire-Header-Order"
+
+// orderedTransport is the Client's default transport. Go writes HTTP/1.1
+// headers in its own order (Host and User-Agent, then alphabetical), so
+// orderedTransport dials its own connections and rewrites each request's
+// header block into its profile's order on the way out. It also dials
+// proxies itself: http.Transport would run TLS over a CONNECT tunnel where
+// the header block can no longer be reached.
+type orderedTransport struct {
+	proxy func(*http.Request) (*url.URL, error)
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport // by proxy URL, "" for direct
+}
+
+func newOrderedTransport(proxy func(*http.Request) (*url.URL, error)) *orderedTransport {
+	return &orderedTransport{proxy: proxy, transports: make(map[string]*http.Transport)}
+}
+
+func (t *orderedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pu, err := t.proxy(req)
+	if err != nil {
+		return nil, err
+	}
+	if order := headerOrderFromContext(req.Context()); len(order) > 0 {
+		req = req.Clone(req.Context())
+		req.Header.Set(orderHeader, strings.Join(order, ","))
+	}
+	return t.transport(pu).RoundTrip(req)
+}
+
+// transport returns the connection pool for requests through pu, or for
+// direct requests when pu is nil.
+func (t *orderedTransport) transport(pu *url.URL) *http.Transport {
+	key := ""
+	if pu != nil {
+		key = pu.String()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.transports[key]; ok {
+		return tr
+	}
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			conn, err := dialVia(ctx, pu, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &orderedConn{Conn: conn}, nil
+		},
+		// HTTP/2 is never negotiated, so every request goes through
+		// orderedConn as HTTP/1.1
+		DialTLSContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			conn, err := dialVia(ctx, pu, addr)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			tc := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+			if err := tc.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return &orderedConn{Conn: tc}, nil
+		},
+		IdleConnTimeout: 90 * time.Second,
+	}
+	t.transports[key] = tr
+	return tr
+}
+
+// dialVia connects to addr, through the proxy pu when it is set.
+func dialVia(ctx context.Context, pu *url.URL, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if pu == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	switch pu.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if pu.User != nil {
+			auth = &proxy.Auth{User: pu.User.Username()}
+			auth.Password, _ = pu.User.Password()
+		}
+		sd, err := proxy.SOCKS5("tcp", proxyAddr(pu), auth, d)
+		if err != nil {
+			return nil, err
+		}
+		return sd.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	case "http", "https":
+		return dialConnect(ctx, d, pu, addr)
+	}
+	return nil, fmt.Errorf("mfire: unsupported proxy scheme %q", pu.Scheme)
+}
+
+// proxyAddr returns the proxy's host:port, filling in the scheme's default
+// port.
+func proxyAddr(pu *url.URL) string {
+	if pu.Port() != "" {
+		return pu.Host
+	}
+	port := "80"
+	switch pu.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(pu.Hostname(), port)
+}
+
+// dialConnect opens a CONNECT tunnel to addr through the HTTP(S) proxy pu.
+func dialConnect(ctx context.Context, d *net.Dialer, pu *url.URL, addr string) (net.Conn, error) {
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr(pu))
+	if err != nil {
+		return nil, err
+	}
+	if pu.Scheme == "https" {
+		tc := tls.Client(conn, &tls.Config{ServerName: pu.Hostname(), InsecureSkipVerify: true})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	// the CONNECT exchange has no context of its own, so a cancelled
+	// request abandons it by closing the connection
+	errc := make(chan error, 1)
+	go func() { errc <- connectTunnel(conn, pu, addr) }()
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		conn.Close()
+		<-errc
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func connectTunnel(conn net.Conn, pu *url.URL, addr string) error {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if pu.User != nil {
+		password, _ := pu.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(pu.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT: bad status: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return fmt.Errorf("proxy CONNECT: unexpected data after the response")
+	}
+	return nil
+}
+
+// orderedConn rewrites the header block of each request written to it into
+// the order its orderHeader names. Request bodies pass through untouched.
+type orderedConn struct {
+	net.Conn
+	buf  []byte // header block written so far
+	body int64  // body bytes left to pass through; -1 for the rest of the connection
+}
+
+func (c *orderedConn) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if c.body < 0 {
+			if _, err := c.Conn.Write(p); err != nil {
+				return 0, err
+			}
+			return n, nil
+		}
+		if c.body > 0 {
+			k := len(p)
+			if int64(k) > c.body {
+				k = int(c.body)
+			}
+			if _, err := c.Conn.Write(p[:k]); err != nil {
+				return 0, err
+			}
+			c.body -= int64(k)
+			p = p[k:]
+			continue
+		}
+		c.buf = append(c.buf, p...)
+		end := bytes.Index(c.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			return n, nil
+		}
+		head, body := reorderHead(c.buf[:end+4])
+		p = append([]byte(nil), c.buf[end+4:]...)
+		c.buf = c.buf[:0]
+		c.body = body
+		if _, err := c.Conn.Write(head); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// reorderHead sorts the header lines of a request's header block by the
+// order in its orderHeader, spelling names the way the order does, and
+// drops the orderHeader. It also reports the length of the body that
+// follows, or -1 for a chunked one.
+func reorderHead(head []byte) ([]byte, int64) {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+	var (
+		order  []string
+		fields []string
+		body   int64
+	)
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		switch {
+		case strings.EqualFold(name, orderHeader):
+			order = strings.Split(strings.TrimSpace(value), ",")
+			continue
+		case strings.EqualFold(name, "Content-Length"):
+			body, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		case strings.EqualFold(name, "Transfer-Encoding"):
+			body = -1
+		}
+		fields = append(fields, line)
+	}
+	rank := func(line string) int {
+		name, _, _ := strings.Cut(line, ":")
+		for i, o := range order {
+			if strings.EqualFold(o, name) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return rank(fields[i]) < rank(fields[j]) })
+
+	var b strings.Builder
+	b.WriteString(lines[0] + "\r\n")
+	for _, line := range fields {
+		if r := rank(line); r < len(order) {
+			_, value, _ := strings.Cut(line, ":")
+			line = order[r] + ":" + value
+		}
+		b.WriteString(line + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String()), body
+}
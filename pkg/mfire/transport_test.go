@@ -0,0 +1,163 @@
+package mfire
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHeaderOrder(t *testing.T) {
+	chrome, _ := LookupProfile("chrome-linux")
+	firefox, _ := LookupProfile("firefox-windows")
+	const (
+		chromeWant  = "Host sec-ch-ua sec-ch-ua-mobile sec-ch-ua-platform Upgrade-Insecure-Requests User-Agent Accept Referer Accept-Encoding Accept-Language Cookie"
+		firefoxWant = "Host User-Agent Accept Accept-Language Accept-Encoding Referer Cookie Upgrade-Insecure-Requests"
+	)
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	certs := srv.TLS.Certificates
+	srv.Close()
+
+	plain := listen(t)
+	secure := tls.NewListener(listen(t), &tls.Config{Certificates: certs})
+	heads := make(chan string, 10)
+	go serveHeads(plain, heads)
+	go serveHeads(secure, heads)
+	proxyLn := listen(t)
+	go serveConnectProxy(t, proxyLn, "Basic dXNlcjpwYXNz") // user:pass
+	proxyURL, _ := url.Parse("http://user:pass@" + proxyLn.Addr().String())
+
+	tests := []struct {
+		name    string
+		profile HeaderProfile
+		scheme  string
+		ln      net.Listener
+		opts    []Option
+		want    string
+	}{
+		{"chrome", chrome, "http", plain, nil, chromeWant},
+		{"firefox", firefox, "http", plain, nil, firefoxWant},
+		{"chrome tls", chrome, "https", secure, nil, chromeWant},
+		{"firefox via proxy", firefox, "https", secure, []Option{WithProxy(proxyURL)}, firefoxWant},
+		{"no order", HeaderProfile{Name: "plain", UserAgent: "ua", Accept: "*/*"}, "http", plain, nil,
+			"Host User-Agent Accept Accept-Language Cookie Referer Upgrade-Insecure-Requests Accept-Encoding"},
+	}
+	for _, tt := range tests {
+		c := NewClient(append(tt.opts, WithHeaderProfile(tt.profile))...)
+		target := &url.URL{Scheme: tt.scheme, Host: tt.ln.Addr().String(), Path: "/"}
+		c.http.Jar.SetCookies(target, []*http.Cookie{{Name: "session", Value: "1"}})
+		// the second request reuses the connection
+		for i := 0; i < 2; i++ {
+			req, err := c.newRequest(context.Background(), target.String(), "https://mangafire.to/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.http.Do(req)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "ok" {
+				t.Errorf("%s: body %q", tt.name, body)
+			}
+			if got := <-heads; got != tt.want {
+				t.Errorf("%s: request %d sent\n%s\nwant\n%s", tt.name, i, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestReorderHead(t *testing.T) {
+	head := "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nUser-Agent: ua\r\n" + orderHeader + ": user-agent,host\r\n\r\n"
+	got, body := reorderHead([]byte(head))
+	want := "POST / HTTP/1.1\r\nuser-agent: ua\r\nhost: a\r\nContent-Length: 4\r\n\r\n"
+	if string(got) != want || body != 4 {
+		t.Errorf("reorderHead = %q, %d; want %q, 4", got, body, want)
+	}
+	if _, body := reorderHead([]byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n")); body != -1 {
+		t.Errorf("chunked body = %d, want -1", body)
+	}
+}
+
+func listen(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+// serveHeads answers every request with "ok" and sends the header names it
+// arrived with, in order, on heads.
+func serveHeads(ln net.Listener, heads chan<- string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			br := bufio.NewReader(conn)
+			for {
+				if _, err := br.ReadString('\n'); err != nil {
+					return
+				}
+				var names []string
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line = strings.TrimRight(line, "\r\n"); line == "" {
+						break
+					}
+					name, _, _ := strings.Cut(line, ":")
+					names = append(names, name)
+				}
+				heads <- strings.Join(names, " ")
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+			}
+		}()
+	}
+}
+
+// serveConnectProxy tunnels CONNECT requests carrying the expected
+// Proxy-Authorization.
+func serveConnectProxy(t *testing.T, ln net.Listener, auth string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				return
+			}
+			if req.Method != "CONNECT" || req.Header.Get("Proxy-Authorization") != auth {
+				t.Errorf("proxy got %s %s with %v", req.Method, req.Host, req.Header)
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+				return
+			}
+			upstream, err := net.Dial("tcp", req.Host)
+			if err != nil {
+				io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+				return
+			}
+			defer upstream.Close()
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n")
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}
+}
@@ -0,0 +1,127 @@
+package mfire
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidURL is returned (wrapped) when a URL doesn't have the shape of a
+// MangaFire manga or reader URL.
+var ErrInvalidURL = errors.New("mfire: not a MangaFire URL")
+
+// MangaRef identifies a manga. ID is stable; Slug is cosmetic and may change
+// when the site edits a title, so key stored data on ID.
+type MangaRef struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+}
+
+// ReaderRef identifies one chapter or volume in one language.
+type ReaderRef struct {
+	MangaRef
+	Language Language `json:"language"` // e.g. "en"
+	Kind     string   `json:"kind"`     // "chapter" or "volume"
+	Number   float64  `json:"number"`   // e.g. 1097.5
+}
+
+// ParseMangaURL parses a manga URL such as
+// "https://mangafire.to/manga/one-piecee.dkw". Relative paths are accepted,
+// and so are reader URLs, whose manga part is returned.
+func ParseMangaURL(raw string) (MangaRef, error) {
+	parts, err := urlParts(raw)
+	if err != nil {
+		return MangaRef{}, err
+	}
+	if len(parts) < 2 || (parts[0] != "manga" && parts[0] != "read") {
+		return MangaRef{}, fmt.Errorf("%w: %q", ErrInvalidURL, raw)
+	}
+	ref, ok := splitSlugID(parts[1])
+	if !ok {
+		return MangaRef{}, fmt.Errorf("%w: %q has no manga id", ErrInvalidURL, raw)
+	}
+	return ref, nil
+}
+
+// ParseReaderURL parses a reader URL such as
+// "https://mangafire.to/read/one-piecee.dkw/en/chapter-1100".
+func ParseReaderURL(raw string) (ReaderRef, error) {
+	parts, err := urlParts(raw)
+	if err != nil {
+		return ReaderRef{}, err
+	}
+	if len(parts) != 4 || parts[0] != "read" {
+		return ReaderRef{}, fmt.Errorf("%w: %q is not a reader URL", ErrInvalidURL, raw)
+	}
+	manga, ok := splitSlugID(parts[1])
+	if !ok {
+		return ReaderRef{}, fmt.Errorf("%w: %q has no manga id", ErrInvalidURL, raw)
+	}
+	kind, num, ok := strings.Cut(parts[3], "-")
+	if !ok || (kind != "chapter" && kind != "volume") {
+		return ReaderRef{}, fmt.Errorf("%w: %q has no chapter or volume", ErrInvalidURL, raw)
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return ReaderRef{}, fmt.Errorf("%w: %q has a bad %s number", ErrInvalidURL, raw, kind)
+	}
+	return ReaderRef{MangaRef: manga, Language: ParseLanguage(parts[2]), Kind: kind, Number: n}, nil
+}
+
+// MangaURL builds the absolute URL of a manga's detail page.
+func MangaURL(slug, id string) string {
+	return "https://mangafire.to/manga/" + slug + "." + id
+}
+
+// URL returns the manga's detail page URL.
+func (r MangaRef) URL() string {
+	return MangaURL(r.Slug, r.ID)
+}
+
+// ReaderURL builds the absolute URL of a chapter or volume in the reader.
+func ReaderURL(manga MangaRef, language Language, kind string, number float64) string {
+	return "https://mangafire.to/read/" + manga.Slug + "." + manga.ID + "/" +
+		string(ParseLanguage(string(language))) + "/" + kind + "-" + FormatNumber(number)
+}
+
+// URL returns the reader URL.
+func (r ReaderRef) URL() string {
+	return ReaderURL(r.MangaRef, r.Language, r.Kind, r.Number)
+}
+
+// FormatNumber formats a chapter or volume number the way the site does:
+// no trailing zeros, so 12 is "12" and 10.5 is "10.5".
+func FormatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// urlParts returns the path segments of a site URL: a relative path or a
+// URL on mangafire.to, with or without www.
+func urlParts(raw string) ([]string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if u.IsAbs() && u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidURL, raw)
+	}
+	if u.Host != "" || u.IsAbs() {
+		switch strings.ToLower(u.Hostname()) {
+		case "mangafire.to", "www.mangafire.to":
+		default:
+			return nil, fmt.Errorf("%w: %q is on another site", ErrInvalidURL, raw)
+		}
+	}
+	return strings.Split(strings.Trim(u.Path, "/"), "/"), nil
+}
+
+// splitSlugID splits "<slug>.<id>" on its last dot.
+func splitSlugID(s string) (MangaRef, bool) {
+	i := strings.LastIndex(s, ".")
+	if i <= 0 || i == len(s)-1 {
+		return MangaRef{}, false
+	}
+	return MangaRef{Slug: s[:i], ID: s[i+1:]}, true
+}
@@ -0,0 +1,89 @@
+package mfire
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMangaURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want MangaRef
+		ok   bool
+	}{
+		{"https://mangafire.to/manga/one-piecee.dkw", MangaRef{ID: "dkw", Slug: "one-piecee"}, true},
+		{"/manga/jujutsu-kaisenn.0w5k", MangaRef{ID: "0w5k", Slug: "jujutsu-kaisenn"}, true},
+		{"https://mangafire.to/manga/dr.-stonee.kq2/", MangaRef{ID: "kq2", Slug: "dr.-stonee"}, true},
+		{"https://mangafire.to/read/one-piecee.dkw/en/chapter-1100", MangaRef{ID: "dkw", Slug: "one-piecee"}, true},
+		{"https://mangafire.to/manga/no-id", MangaRef{}, false},
+		{"https://mangafire.to/genre/action", MangaRef{}, false},
+		{"ftp://mangafire.to/manga/x.y", MangaRef{}, false},
+		{"http://www.MangaFire.to/manga/one-piecee.dkw", MangaRef{ID: "dkw", Slug: "one-piecee"}, true},
+		{"https://evil.example/manga/one-piecee.dkw", MangaRef{}, false},
+		{"https://mangafire.to.evil.example/manga/one-piecee.dkw", MangaRef{}, false},
+		{"//evil.example/manga/one-piecee.dkw", MangaRef{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseMangaURL(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseMangaURL(%q) err = %v", tt.in, err)
+			continue
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("ParseMangaURL(%q) err = %v, want ErrInvalidURL", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseMangaURL(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseReaderURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ReaderRef
+		ok   bool
+	}{
+		{"https://mangafire.to/read/one-piecee.dkw/en/chapter-1100",
+			ReaderRef{MangaRef{"dkw", "one-piecee"}, "en", "chapter", 1100}, true},
+		{"/read/solo-levelingg.5q2/pt-br/chapter-179.5",
+			ReaderRef{MangaRef{"5q2", "solo-levelingg"}, "pt-br", "chapter", 179.5}, true},
+		{"/read/one-piecee.dkw/EN/volume-107",
+			ReaderRef{MangaRef{"dkw", "one-piecee"}, "en", "volume", 107}, true},
+		{"/read/one-piecee.dkw/en/episode-3", ReaderRef{}, false},
+		{"/read/one-piecee.dkw/en/chapter-x", ReaderRef{}, false},
+		{"/manga/one-piecee.dkw", ReaderRef{}, false},
+		{"https://www.mangafire.to/read/one-piecee.dkw/en/chapter-1100",
+			ReaderRef{MangaRef{"dkw", "one-piecee"}, "en", "chapter", 1100}, true},
+		{"https://mirror.example/read/one-piecee.dkw/en/chapter-1100", ReaderRef{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseReaderURL(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseReaderURL(%q) err = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReaderURL(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestURLBuildersRoundTrip(t *testing.T) {
+	for _, raw := range []string{
+		"https://mangafire.to/read/one-piecee.dkw/en/chapter-1100",
+		"https://mangafire.to/read/solo-levelingg.5q2/pt-br/chapter-179.5",
+		"https://mangafire.to/read/one-piecee.dkw/fr/volume-107",
+	} {
+		ref, err := ParseReaderURL(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ref.URL(); got != raw {
+			t.Errorf("ReaderRef.URL() = %q, want %q", got, raw)
+		}
+	}
+	if got := (MangaRef{ID: "dkw", Slug: "one-piecee"}).URL(); got != "https://mangafire.to/manga/one-piecee.dkw" {
+		t.Errorf("MangaRef.URL() = %q", got)
+	}
+}